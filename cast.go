@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	Cast = RegisterKind("Cast") // starts or stops casting
+)
+
+// Caster is a Screen recording every flushed frame of the Screen it wraps
+// to an asciicast v2 file, see https://docs.asciinema.org/manual/asciicast/v2/.
+// It is a System toggling the recording on Cast. A recording stops when
+// the file would grow beyond its size limit. Existing casts are never
+// overwritten, the recordings are numbered instead, e.g. game-2.cast.
+type Caster struct {
+	Screen
+	engine *Engine
+	path   string
+	max    int64
+
+	name    string // of the current file
+	file    *os.File
+	w       *bufio.Writer
+	written int64
+	start   time.Time
+	now     func() time.Time
+
+	width, height int
+	back, front   []screenCell // drawn and last recorded frame
+	attr          screenCell   // colors of the last recorded cell
+	full          bool         // the next frame is recorded completely
+	resized       bool         // the next frame is recorded after a resize event
+}
+
+func NewCaster(e *Engine, s Screen, path string, max int64) *Caster {
+	return &Caster{
+		Screen: s,
+		engine: e,
+		path:   path,
+		max:    max,
+		now:    time.Now,
+	}
+}
+
+func (c *Caster) Handle(m Message) {
+	switch {
+	case m.Kind(Cast):
+		if c.file != nil {
+			c.stop(fmt.Sprintf("cast saved to %v", c.name))
+		} else {
+			c.begin()
+		}
+
+	case m.Kind(Quit):
+		if c.file != nil {
+			c.stop("")
+		}
+	}
+}
+
+// asciicast is the header of an asciicast v2 file
+type asciicast struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func (c *Caster) begin() {
+	f, err := c.create()
+	if err != nil {
+		c.engine.Publish(Message{Error, &Failure{"cast", err, false}})
+		return
+	}
+
+	c.file, c.w, c.written = f, bufio.NewWriter(f), 0
+	c.start = c.now()
+	c.width, c.height = c.Size()
+	c.resize()
+
+	header, _ := json.Marshal(asciicast{
+		Version:   2,
+		Width:     c.width,
+		Height:    c.height,
+		Timestamp: c.start.Unix(),
+		Env:       map[string]string{"TERM": os.Getenv("TERM")},
+	})
+	c.write(append(header, '\n'))
+	c.engine.Publish(Message{Status, fmt.Sprintf("casting to %v", c.name)})
+}
+
+// create creates the first file of path and its numbered variants not
+// existing yet
+func (c *Caster) create() (*os.File, error) {
+	ext := filepath.Ext(c.path)
+	for i := 1; ; i++ {
+		c.name = c.path
+		if i > 1 {
+			c.name = fmt.Sprintf("%v-%d%v", strings.TrimSuffix(c.path, ext), i, ext)
+		}
+		f, err := os.OpenFile(c.name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// stop closes the file and reports status, if not empty
+func (c *Caster) stop(status string) {
+	err := c.w.Flush()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file, c.w = nil, nil
+
+	switch {
+	case err != nil:
+		c.engine.Publish(Message{Error, &Failure{"cast", err, false}})
+	case status != "":
+		c.engine.Publish(Message{Status, status})
+	}
+}
+
+func (c *Caster) write(b []byte) {
+	n, _ := c.w.Write(b)
+	c.written += int64(n)
+}
+
+// event records an output or resize event, unless it exceeds the size limit
+func (c *Caster) event(code, data string) {
+	ev, _ := json.Marshal([]interface{}{c.now().Sub(c.start).Seconds(), code, data})
+	if c.max > 0 && c.written+int64(len(ev))+1 > c.max {
+		c.stop(fmt.Sprintf("cast saved to %v, size limit reached", c.name))
+		return
+	}
+	c.write(append(ev, '\n'))
+}
+
+func (c *Caster) resize() {
+	c.back = make([]screenCell, c.width*c.height)
+	c.front = make([]screenCell, c.width*c.height)
+	c.full = true
+}
+
+// Clear starts a frame, at the current size of the Screen.
+func (c *Caster) Clear(fg, bg Color) {
+	if w, h := c.Size(); w != c.width || h != c.height {
+		c.width, c.height = w, h
+		c.resize()
+		c.resized = true
+	}
+	for i := range c.back {
+		c.back[i] = screenCell{' ', fg, bg}
+	}
+	c.Screen.Clear(fg, bg)
+}
+
+func (c *Caster) SetCell(x, y int, ch rune, fg, bg Color) {
+	if x >= 0 && y >= 0 && x < c.width && y < c.height {
+		c.back[y*c.width+x] = screenCell{ch, fg, bg}
+	}
+	c.Screen.SetCell(x, y, ch, fg, bg)
+}
+
+// Flush records the cells changed since the last frame.
+func (c *Caster) Flush() error {
+	if c.file != nil && c.resized {
+		c.event("r", fmt.Sprintf("%dx%d", c.width, c.height))
+	}
+	if c.file != nil {
+		c.record()
+	}
+	c.resized = false
+	return c.Screen.Flush()
+}
+
+// record writes the frame as ANSI escape sequences
+func (c *Caster) record() {
+	var b strings.Builder
+	if c.full {
+		b.WriteString("\x1b[?25l\x1b[0m\x1b[2J")
+		c.attr = screenCell{fg: ColorDefault, bg: ColorDefault}
+	}
+
+	next := -1 // index the cursor is at
+	for i, cell := range c.back {
+		if !c.full && cell == c.front[i] {
+			continue
+		}
+		if i != next {
+			fmt.Fprintf(&b, "\x1b[%d;%dH", i/c.width+1, i%c.width+1)
+		}
+		if cell.fg != c.attr.fg || cell.bg != c.attr.bg {
+			fmt.Fprintf(&b, "\x1b[%d;%dm", sgr(cell.fg, 39, 30), sgr(cell.bg, 49, 40))
+			c.attr = cell
+		}
+		ch := cell.ch
+		if ch == 0 {
+			ch = ' '
+		}
+		b.WriteRune(ch)
+		next = i + 1
+		if next%c.width == 0 {
+			next = -1 // the cursor does not wrap
+		}
+	}
+	copy(c.front, c.back)
+	c.full = false
+
+	if b.Len() > 0 {
+		c.event("o", b.String())
+	}
+}
+
+// sgr returns the parameter selecting color, offset by the one of black
+func sgr(color Color, def, black int) int {
+	if color == ColorDefault || color > ColorWhite {
+		return def
+	}
+	return black + int(color-ColorBlack)
+}
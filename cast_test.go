@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCaster records to x.cast in a temporary directory, one second
+// passes per event
+func testCaster(t *testing.T, max int64) (*Caster, *MemoryScreen, *[]string, *Engine) {
+	e := NewEngine()
+	var status []string
+	e.SubscribeFunc(func(m Message) { status = append(status, m.Payload.(string)) }, Status)
+
+	screen := NewMemoryScreen(6, 3)
+	c := NewCaster(e, screen, filepath.Join(t.TempDir(), "x.cast"), max)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return c, screen, &status, e
+}
+
+// readCast returns the header and the events of a cast
+func readCast(t *testing.T, name string) (asciicast, [][]interface{}) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var header asciicast
+	var events [][]interface{}
+	sc := bufio.NewScanner(f)
+	for n := 0; sc.Scan(); n++ {
+		v := interface{}(&header)
+		if n > 0 {
+			events = append(events, nil)
+			v = &events[len(events)-1]
+		}
+		if err := json.Unmarshal(sc.Bytes(), v); err != nil {
+			t.Fatalf("line %d: %v", n+1, err)
+		}
+	}
+	return header, events
+}
+
+func TestCaster(t *testing.T) {
+	c, screen, status, e := testCaster(t, 0)
+	frame := func(cells ...screenCell) {
+		c.Clear(ColorDefault, ColorDefault)
+		for i, cell := range cells {
+			c.SetCell(i, 1, cell.ch, cell.fg, cell.bg)
+		}
+		c.Flush()
+	}
+
+	c.Handle(Message{Flags: Cast})
+	frame(screenCell{'a', ColorRed, ColorDefault})
+	frame(screenCell{'a', ColorRed, ColorDefault}, screenCell{'b', ColorDefault, ColorBlue})
+	frame(screenCell{'a', ColorRed, ColorDefault}, screenCell{'b', ColorDefault, ColorBlue})
+	screen.Resize(4, 2)
+	frame()
+	c.Handle(Message{Flags: Cast})
+
+	// never overwritten
+	c.Handle(Message{Flags: Cast})
+	frame()
+	c.Handle(Message{Flags: Quit})
+	e.Close()
+
+	header, events := readCast(t, c.path)
+	if header.Version != 2 || header.Width != 6 || header.Height != 3 || header.Timestamp != 1001 {
+		t.Errorf("header %+v", header)
+	}
+	if len(events) != 4 {
+		t.Fatalf("recorded %v, want 4 events", events)
+	}
+	if ev := events[0]; ev[0] != 1.0 || ev[1] != "o" || !strings.HasPrefix(ev[2].(string), "\x1b[?25l\x1b[0m\x1b[2J") || !strings.Contains(ev[2].(string), "\x1b[31;49ma") {
+		t.Errorf("first frame is not full: %v", ev)
+	}
+	// the unchanged third frame is not recorded
+	if want := []interface{}{2.0, "o", "\x1b[2;2H\x1b[39;44mb"}; !reflect.DeepEqual(events[1], want) {
+		t.Errorf("second frame %v, want only the changed cell %v", events[1], want)
+	}
+	if want := []interface{}{3.0, "r", "4x2"}; !reflect.DeepEqual(events[2], want) {
+		t.Errorf("resized to %v, want %v", events[2], want)
+	}
+	if ev := events[3]; ev[1] != "o" || !strings.HasPrefix(ev[2].(string), "\x1b[?25l\x1b[0m\x1b[2J") {
+		t.Errorf("frame after resize is not full: %v", ev)
+	}
+
+	second := strings.TrimSuffix(c.path, ".cast") + "-2.cast"
+	if header, events := readCast(t, second); header.Width != 4 || len(events) != 1 {
+		t.Errorf("second cast %+v with %v", header, events)
+	}
+	want := []string{"casting to " + c.path, "cast saved to " + c.path, "casting to " + second}
+	if !reflect.DeepEqual(*status, want) {
+		t.Errorf("status %q, want %q", *status, want)
+	}
+}
+
+func TestCasterLimit(t *testing.T) {
+	const max = 400
+	c, _, status, e := testCaster(t, max)
+
+	c.Handle(Message{Flags: Cast})
+	for i := 0; i < 20; i++ {
+		c.Clear(ColorDefault, ColorDefault)
+		c.SetCell(i%6, i%3, 'x', ColorGreen, ColorDefault)
+		c.Flush()
+	}
+	stopped := c.file == nil
+	e.Close()
+
+	if !stopped {
+		t.Error("still recording beyond the size limit")
+	}
+	st, err := os.Stat(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() > max {
+		t.Errorf("cast has %d bytes, want at most %d", st.Size(), max)
+	}
+	if _, events := readCast(t, c.path); len(events) < 2 || len(events) >= 20 {
+		t.Errorf("recorded %d frames", len(events))
+	}
+	if s := *status; len(s) != 2 || !strings.HasSuffix(s[1], "size limit reached") {
+		t.Errorf("status %q", s)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// command runs a command of the command line with its arguments
+type command struct {
+	args string // usage of the arguments
+	run  func(gs *GameState, args []string) error
+}
+
+// commands of the command line, it is opened with ':'
+var commands = map[string]command{
+	"idle":        {"", modeCommand(ModeIdle)},
+	"residential": {"", modeCommand(ModeResidential)},
+	"commercial":  {"", modeCommand(ModeCommercial)},
+	"industrial":  {"", modeCommand(ModeIndustrial)},
+	"delete":      {"", modeCommand(ModeDelete)},
+	"size": {"1-3", func(gs *GameState, args []string) error {
+		n, err := intArg(args, LowBuilding, HighBuilding)
+		if err == nil {
+			gs.setSize(n)
+		}
+		return err
+	}},
+	"speed": {"1-4", func(gs *GameState, args []string) error {
+		n, err := intArg(args, 1, 4)
+		if err == nil {
+			gs.setSpeed(n)
+		}
+		return err
+	}},
+	"pause": {"", func(gs *GameState, args []string) error {
+		gs.setPaused(!gs.paused)
+		return nil
+	}},
+	"save": {"[name]", func(gs *GameState, args []string) error {
+		path, err := saveArg(args)
+		if err == nil {
+			gs.saveGame(path)
+		}
+		return err
+	}},
+	"load": {"[name]", func(gs *GameState, args []string) error {
+		path, err := saveArg(args)
+		if err == nil {
+			gs.loadGame(path)
+		}
+		return err
+	}},
+	"quit": {"", func(gs *GameState, args []string) error {
+		gs.quit()
+		return nil
+	}},
+}
+
+func modeCommand(mode ClickMode) func(*GameState, []string) error {
+	return func(gs *GameState, args []string) error {
+		gs.setMode(mode)
+		return nil
+	}
+}
+
+// intArg parses the single argument as a number from min to max
+func intArg(args []string, min, max int) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a number")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%q is not a number from %d to %d", args[0], min, max)
+	}
+	return n, nil
+}
+
+// saveArg returns the file named by the argument, defaultSave if there is
+// none. The command line is reachable from browsers, so a name is a file
+// in the working directory with the extension .save, added if missing,
+// and never a path.
+func saveArg(args []string) (string, error) {
+	if len(args) == 0 {
+		return defaultSave, nil
+	}
+	name := strings.Join(args, " ")
+	if strings.ContainsAny(name, `/\:`) || strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("%q is not a name, saves are kept in the working directory", name)
+	}
+	if !strings.HasSuffix(name, ".save") {
+		name += ".save"
+	}
+	return name, nil
+}
+
+// edit types into the command line
+func (gs *GameState) edit(ke KeyEvent) {
+	switch {
+	case ke.Key == termbox.KeyEsc:
+		gs.prompt = false
+	case ke.Key == termbox.KeyEnter:
+		gs.prompt = false
+		gs.execute(string(gs.command))
+	case ke.Key == termbox.KeyBackspace || ke.Key == termbox.KeyBackspace2:
+		if len(gs.command) > 0 {
+			gs.command = gs.command[:len(gs.command)-1]
+		} else {
+			gs.prompt = false
+		}
+	case ke.Key == termbox.KeySpace:
+		gs.command = append(gs.command, ' ')
+	case ke.Key == 0 && ke.Mod == 0 && ke.Ch != 0:
+		gs.command = append(gs.command, ke.Ch)
+	}
+}
+
+// execute runs a line of the command line, any unambiguous prefix of a
+// command runs it
+func (gs *GameState) execute(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	var found []string
+	for name := range commands {
+		if name == fields[0] {
+			found = []string{name}
+			break
+		}
+		if strings.HasPrefix(name, fields[0]) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+
+	switch len(found) {
+	case 0:
+		gs.console = fmt.Sprintf("unknown command %q", fields[0])
+	case 1:
+		cmd := commands[found[0]]
+		if err := cmd.run(gs, fields[1:]); err != nil {
+			gs.console = fmt.Sprintf("%v %v: %v", found[0], cmd.args, err)
+		}
+	default:
+		gs.console = fmt.Sprintf("%q is one of %v", fields[0], strings.Join(found, ", "))
+	}
+}
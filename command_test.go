@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSaveArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string // empty if rejected
+	}{
+		{nil, defaultSave},
+		{[]string{"city"}, "city.save"},
+		{[]string{"city.save"}, "city.save"},
+		{[]string{"my", "city"}, "my city.save"},
+		{[]string{"~/.bashrc"}, ""},
+		{[]string{"/etc/passwd"}, ""},
+		{[]string{"../city"}, ""},
+		{[]string{"saves/city"}, ""},
+		{[]string{`..\city`}, ""},
+		{[]string{"C:city"}, ""},
+		{[]string{".bashrc"}, ""},
+		{[]string{".."}, ""},
+	}
+	for _, tt := range tests {
+		got, err := saveArg(tt.args)
+		if tt.want == "" && err == nil {
+			t.Errorf("saveArg(%q) = %q, want an error", tt.args, got)
+		}
+		if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("saveArg(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestExecuteSave(t *testing.T) {
+	e := NewEngine()
+	gs := NewGameState(e, NewMemoryScreen(40, 12), NewWorld(e), NewScheduler(e))
+	var saved []string
+	e.SubscribeFunc(func(m Message) { saved = append(saved, m.Payload.(*SaveState).Path) }, Save)
+
+	gs.execute("save ../../.bashrc")
+	if !strings.Contains(gs.console, "is not a name") {
+		t.Errorf("console is %q", gs.console)
+	}
+	gs.execute("sa city")
+	e.Close()
+
+	if len(saved) != 1 || saved[0] != "city.save" {
+		t.Errorf("saved %q, want only city.save", saved)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+var (
+	Workday = RegisterKind("Workday") // a game day of the economy begins
+)
+
+const (
+	// gophers living in, or working at, a cell of every level, see docs.go
+	gophersPerCell = 4
+	// cells per game tick
+	commuteSpeed = 0.2
+)
+
+// capacity of a building with footprint r
+func capacity(r Rect) int {
+	return gophersPerCell * r.W * r.H * Levels(r)
+}
+
+// Economy is a System running the simulation of gophers and the
+// buildings zoned on the map. Every Workday the gophers shop, work and
+// sleep, every gopher that worked commutes visibly from home to work.
+type Economy struct {
+	engine *Engine
+	world  *World
+	random *rand.Rand // seeded, so a replayed session makes the same choices
+
+	gophers   Gophers
+	spatial   *spatialSystem
+	buildings map[Entity]interface{} // *Residential, *Commercial or *Industrial
+	sites     map[interface{}]Rect
+	commuters map[*Gopher]Entity
+	named     int
+}
+
+func NewEconomy(e *Engine, w *World) *Economy {
+	e.Publish(Message{Schedule, Every(Days(1), Message{Flags: Workday})})
+
+	return &Economy{
+		engine:    e,
+		world:     w,
+		random:    rand.New(rand.NewSource(42)),
+		spatial:   newSpatialSystem(),
+		buildings: make(map[Entity]interface{}),
+		sites:     make(map[interface{}]Rect),
+		commuters: make(map[*Gopher]Entity),
+	}
+}
+
+func (ec *Economy) Handle(m Message) {
+	switch {
+	case m.Kind(Kinds(Add, Zoning)):
+		ec.build(m.Payload.(EntityEvent).Entity)
+
+	case m.Kind(Kinds(Remove, Zoning)):
+		ec.demolish(m.Payload.(EntityEvent).Entity)
+
+	case m.Kind(Workday):
+		ec.work()
+
+	case m.Kind(Save):
+		m.Payload.(*SaveState).Economy = ec.save()
+
+	case m.Kind(Restore):
+		ec.restore(m.Payload.(*SaveState).Economy)
+
+	case m.Kind(Remove.Or(Route)):
+		// commuter is back home
+		for g, e := range ec.commuters {
+			if e == m.Payload.(EntityEvent).Entity {
+				delete(ec.commuters, g)
+				break
+			}
+		}
+	}
+}
+
+func (ec *Economy) build(e Entity) {
+	fp, ok := Get[Rect](ec.world, e, Geometry)
+	if !ok {
+		return
+	}
+	mode, ok := Get[ClickMode](ec.world, e, Zoning)
+	if !ok {
+		return
+	}
+
+	size := capacity(fp)
+	var b interface{}
+	switch mode {
+	case ModeResidential:
+		residents := make([]*Gopher, size)
+		for i := range residents {
+			residents[i] = NewGopher(gopherNames[ec.named%len(gopherNames)])
+			ec.named++
+		}
+		r := NewResidential(size, residents)
+		for _, g := range residents {
+			g.home = r
+		}
+		ec.gophers = append(ec.gophers, residents...)
+		ec.spatial.AddResidentials(r)
+		b = r
+	case ModeCommercial:
+		c := NewCommercial(size, nil)
+		ec.spatial.AddCommercials(c)
+		b = c
+	case ModeIndustrial:
+		i := NewIndustrial(size, nil)
+		ec.spatial.AddIndustrials(i)
+		b = i
+	default:
+		return
+	}
+
+	ec.buildings[e] = b
+	ec.sites[b] = fp
+}
+
+func (ec *Economy) demolish(e Entity) {
+	b, ok := ec.buildings[e]
+	if !ok {
+		return
+	}
+	delete(ec.buildings, e)
+	delete(ec.sites, b)
+
+	switch b := b.(type) {
+	case *Residential:
+		ec.spatial.RemoveResidential(b)
+		for _, g := range b.residents {
+			if g.job != nil {
+				g.job.RemoveWorker(g)
+			}
+			ec.gophers.remove(g)
+			if c, ok := ec.commuters[g]; ok {
+				ec.world.Destroy(c)
+			}
+		}
+	case *Commercial:
+		ec.spatial.RemoveCommercial(b)
+		for _, g := range b.workers {
+			g.job = nil
+		}
+	case *Industrial:
+		ec.spatial.RemoveIndustrial(b)
+		for _, g := range b.workers {
+			g.job = nil
+		}
+	}
+}
+
+func (gs *Gophers) remove(g *Gopher) {
+	for i, o := range *gs {
+		if o == g {
+			*gs = append((*gs)[:i], (*gs)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ec *Economy) work() {
+	ec.gophers.Shuffle(ec.random)
+	ec.gophers.Shop(ec.spatial)
+	ec.gophers.Work(ec.spatial)
+
+	for _, g := range ec.gophers {
+		if g.HasWorked() && g.job != nil {
+			ec.commute(g)
+		}
+	}
+
+	ec.gophers.Sleep()
+}
+
+// commute sends g on its way from home to work, unless it still is
+func (ec *Economy) commute(g *Gopher) {
+	if _, ok := ec.commuters[g]; ok {
+		return
+	}
+	home, ok := ec.sites[g.home]
+	if !ok {
+		return
+	}
+	work, ok := ec.sites[g.job]
+	if !ok {
+		return
+	}
+
+	from, to := home.Center(), work.Center()
+	w := ec.world
+	e := w.Create()
+	Set(w, e, Position, from)
+	Set(w, e, Velocity, from.Towards(to, commuteSpeed))
+	Set(w, e, Route, Trip{Home: from, Work: to})
+	ec.commuters[g] = e
+}
+
+// EconomyState is the saved Economy. Gophers and buildings refer to each
+// other by their index in Gophers.
+type EconomyState struct {
+	Gophers   []GopherState   `json:"gophers"`
+	Buildings []BuildingState `json:"buildings"`
+	Named     int             `json:"named"`
+}
+
+type GopherState struct {
+	Name      string  `json:"name"`
+	Worked    bool    `json:"worked"`
+	Shopped   bool    `json:"shopped"`
+	Happiness float64 `json:"happiness"`
+	Commute   Entity  `json:"commute,omitempty"`
+}
+
+// BuildingState is a zoned building, its members are the residents of a
+// residential and the workers of a commercial or industrial building.
+type BuildingState struct {
+	Entity   Entity  `json:"entity"`
+	Products float64 `json:"products,omitempty"`
+	Goods    float64 `json:"goods,omitempty"`
+	Members  []int   `json:"members"`
+}
+
+// save encodes the buildings in the order they are simulated
+func (ec *Economy) save() *EconomyState {
+	st := &EconomyState{Named: ec.named}
+
+	index := make(map[*Gopher]int)
+	for i, g := range ec.gophers {
+		index[g] = i
+		st.Gophers = append(st.Gophers, GopherState{
+			Name:      g.name,
+			Worked:    g.worked,
+			Shopped:   g.shopped,
+			Happiness: g.happiness,
+			Commute:   ec.commuters[g],
+		})
+	}
+	entities := make(map[interface{}]Entity)
+	for e, b := range ec.buildings {
+		entities[b] = e
+	}
+	members := func(gs []*Gopher) []int {
+		r := []int{}
+		for _, g := range gs {
+			r = append(r, index[g])
+		}
+		return r
+	}
+
+	for _, r := range ec.spatial.Residentials() {
+		st.Buildings = append(st.Buildings, BuildingState{
+			Entity:  entities[r],
+			Members: members(r.residents),
+		})
+	}
+	for _, c := range ec.spatial.Commercials() {
+		st.Buildings = append(st.Buildings, BuildingState{
+			Entity:   entities[c],
+			Products: c.products,
+			Goods:    c.goods,
+			Members:  members(c.workers),
+		})
+	}
+	for _, i := range ec.spatial.Industrials() {
+		st.Buildings = append(st.Buildings, BuildingState{
+			Entity:   entities[i],
+			Products: i.products,
+			Members:  members(i.workers),
+		})
+	}
+	return st
+}
+
+// restore replaces all gophers and buildings, the World has to be
+// restored before
+func (ec *Economy) restore(st *EconomyState) {
+	ec.spatial.Reset()
+	ec.gophers = nil
+	ec.buildings = make(map[Entity]interface{})
+	ec.sites = make(map[interface{}]Rect)
+	ec.commuters = make(map[*Gopher]Entity)
+	ec.named = st.Named
+
+	for _, gs := range st.Gophers {
+		g := &Gopher{
+			name:      gs.Name,
+			worked:    gs.Worked,
+			shopped:   gs.Shopped,
+			happiness: gs.Happiness,
+		}
+		if gs.Commute != 0 {
+			ec.commuters[g] = gs.Commute
+		}
+		ec.gophers = append(ec.gophers, g)
+	}
+
+	for _, bs := range st.Buildings {
+		fp, _ := Get[Rect](ec.world, bs.Entity, Geometry)
+		mode, _ := Get[ClickMode](ec.world, bs.Entity, Zoning)
+		members := make([]*Gopher, len(bs.Members))
+		for i, m := range bs.Members {
+			members[i] = ec.gophers[m]
+		}
+
+		var b interface{}
+		switch mode {
+		case ModeResidential:
+			r := NewResidential(capacity(fp), members)
+			for _, g := range members {
+				g.home = r
+			}
+			ec.spatial.AddResidentials(r)
+			b = r
+		case ModeCommercial:
+			c := NewCommercial(capacity(fp), members)
+			c.products, c.goods = bs.Products, bs.Goods
+			for _, g := range members {
+				g.job = c
+			}
+			ec.spatial.AddCommercials(c)
+			b = c
+		case ModeIndustrial:
+			i := NewIndustrial(capacity(fp), members)
+			i.products = bs.Products
+			for _, g := range members {
+				g.job = i
+			}
+			ec.spatial.AddIndustrials(i)
+			b = i
+		}
+		ec.buildings[bs.Entity] = b
+		ec.sites[b] = fp
+	}
+}
+
+// validate checks the references to the zoned buildings and commuters
+// of the saved World, every gopher must live in exactly one building and
+// work in at most one.
+func (st *EconomyState) validate(zoned map[Entity]ClickMode, footprints map[Entity]Rect, commuters map[Entity]bool) error {
+	homes := make([]int, len(st.Gophers))
+	jobs := make([]int, len(st.Gophers))
+	seen := make(map[Entity]bool)
+
+	for _, bs := range st.Buildings {
+		mode, ok := zoned[bs.Entity]
+		if !ok {
+			return fmt.Errorf("economy: building %d is not zoned", bs.Entity)
+		}
+		fp, ok := footprints[bs.Entity]
+		if !ok {
+			return fmt.Errorf("economy: building %d has no footprint", bs.Entity)
+		}
+		if seen[bs.Entity] {
+			return fmt.Errorf("economy: building %d is duplicated", bs.Entity)
+		}
+		seen[bs.Entity] = true
+
+		if len(bs.Members) > capacity(fp) {
+			return fmt.Errorf("economy: building %d has %d members, capacity is %d", bs.Entity, len(bs.Members), capacity(fp))
+		}
+		for _, m := range bs.Members {
+			if m < 0 || m >= len(st.Gophers) {
+				return fmt.Errorf("economy: building %d: no gopher %d", bs.Entity, m)
+			}
+			switch mode {
+			case ModeResidential:
+				homes[m]++
+			case ModeCommercial, ModeIndustrial:
+				jobs[m]++
+			default:
+				return fmt.Errorf("economy: building %d has invalid zoning %d", bs.Entity, mode)
+			}
+		}
+	}
+	if len(seen) != len(zoned) {
+		return fmt.Errorf("economy: %d buildings for %d zoned entities", len(seen), len(zoned))
+	}
+
+	for i, g := range st.Gophers {
+		switch {
+		case homes[i] != 1:
+			return fmt.Errorf("economy: gopher %d lives in %d buildings", i, homes[i])
+		case jobs[i] > 1:
+			return fmt.Errorf("economy: gopher %d works in %d buildings", i, jobs[i])
+		case g.Commute != 0 && !commuters[g.Commute]:
+			return fmt.Errorf("economy: gopher %d commutes as %d, which is not on a route", i, g.Commute)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testEconomy struct {
+	engine  *Engine
+	world   *World
+	economy *Economy
+}
+
+func newTestEconomy() *testEconomy {
+	e := NewEngine()
+	w := NewWorld(e)
+	ec := NewEconomy(e, w)
+	e.Subscribe(ec, Workday, Kinds(Add, Zoning), Kinds(Remove, Zoning), Kinds(Remove, Route))
+	return &testEconomy{e, w, ec}
+}
+
+func (te *testEconomy) zone(r Rect, mode ClickMode) {
+	e := te.world.Create()
+	Set(te.world, e, Geometry, r)
+	Set(te.world, e, Zoning, mode)
+}
+
+// two games in one process must not share buildings or randomness
+func TestEconomyGames(t *testing.T) {
+	var games [3]*testEconomy
+	for i := range games {
+		games[i] = newTestEconomy()
+	}
+	for _, te := range games[:2] {
+		te.zone(Rect{0, 0, 2, 2}, ModeResidential)
+		te.zone(Rect{5, 0, 1, 1}, ModeCommercial)
+		te.zone(Rect{0, 5, 1, 1}, ModeIndustrial)
+	}
+	games[2].zone(Rect{0, 0, 1, 1}, ModeResidential)
+
+	for day := 0; day < 3; day++ {
+		for _, te := range games {
+			te.engine.Publish(Message{Flags: Workday})
+		}
+	}
+	for _, te := range games {
+		te.engine.Close()
+	}
+
+	a, b, c := games[0].economy, games[1].economy, games[2].economy
+	if n := len(a.spatial.Commercials()); n != 1 {
+		t.Errorf("first game has %d commercials, want 1", n)
+	}
+	if n, m := len(c.spatial.Residentials()), len(c.spatial.Commercials()); n != 1 || m != 0 {
+		t.Errorf("third game has %d residentials and %d commercials, want 1 and 0", n, m)
+	}
+	if len(a.commuters) == 0 {
+		t.Error("no gopher commutes")
+	}
+
+	sa, sb := a.save(), b.save()
+	if !reflect.DeepEqual(sa, sb) {
+		t.Errorf("games zoned alike differ:\n%+v\n%+v", sa, sb)
+	}
+}
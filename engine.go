@@ -1,5 +1,14 @@
 package main
 
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 type Message struct {
 	Flags   Kind
 	Payload interface{}
@@ -17,31 +26,367 @@ type SystemFunc func(Message)
 
 func (f SystemFunc) Handle(m Message) { f(m) }
 
+// Engine routes messages to subscribed Systems. Publish may be called
+// from any goroutine; all messages are delivered by a single dispatch
+// goroutine, so a System never sees two messages at the same time.
 type Engine struct {
-	// sync.RWMutex
-	subscribers map[Kind][]System // replace with tree
+	sync.RWMutex
+	subscribers kindTree
+	all         []*Subscription
+	middleware  []Middleware
+	panicLog    io.Writer
+	maxFailures int
+
+	qmu       sync.Mutex
+	queue     []Message
+	posted    []Message
+	maxQueued int
+	closed    bool // no more wake ups, the loop is finishing
+	stopped   bool // the loop has finished, messages are dropped
+	wake      chan struct{}
+	done      chan struct{}
 }
 
 func NewEngine() *Engine {
-	return &Engine{
-		subscribers: make(map[Kind][]System),
+	e := &Engine{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Phase orders the delivery of a single message. All Systems of an earlier
+// Phase are called before any System of a later one, within a Phase
+// Systems are called in the order they subscribed.
+type Phase int
+
+const (
+	PhaseInput Phase = iota
+	PhaseSimulation
+	PhasePostSimulation
+	PhaseRender
+)
+
+// Match selects the messages of a subscription. A message matches if its
+// flags contain All, intersect Any (unless Any is None), do not intersect
+// Not, and Where, if set, returns true for it.
+type Match struct {
+	All   Kind
+	Any   Kind
+	Not   Kind
+	Where func(Message) bool
+}
+
+// keys returns the Kinds the subscription is indexed by
+func (ma Match) keys() []Kind {
+	if ma.Any.IsZero() {
+		return []Kind{ma.All}
+	}
+
+	var keys []Kind
+	for i, l := 0, ma.Any.Len(); i < l; i++ {
+		if ma.Any.Has(i) {
+			keys = append(keys, ma.All.Or(singleKind(i)))
+		}
+	}
+	return keys
+}
+
+// accepts checks the conditions the index does not cover
+func (ma Match) accepts(m Message) bool {
+	if m.Flags.Intersects(ma.Not) {
+		return false
+	}
+	return ma.Where == nil || ma.Where(m)
+}
+
+// Subscription is the handle of a System subscribed to one or more Kinds.
+type Subscription struct {
+	engine    *Engine
+	system    System
+	handler   System // system wrapped in the middleware, guarded by the engine lock
+	kinds     []Kind
+	match     Match
+	phase     Phase
+	seq       uint64
+	cancelled atomic.Bool
+
+	name     string
+	stats    handlerStats
+	failures int // panics, only touched by the dispatch goroutine
+}
+
+// Cancel detaches the System from all Kinds of the Subscription. It may be
+// called from any goroutine, including from within a System while a
+// message is being delivered; the System is not called again afterwards.
+func (s *Subscription) Cancel() {
+	if s.cancelled.Swap(true) {
+		return
+	}
+
+	e := s.engine
+	e.Lock()
+	defer e.Unlock()
+	for _, k := range s.kinds {
+		e.subscribers.remove(k, s)
+	}
+	for i, o := range e.all {
+		if o == s {
+			e.all = append(e.all[:i:i], e.all[i+1:]...)
+			break
+		}
 	}
 }
 
-func (e *Engine) Subscribe(k Kind, s System) {
-	e.subscribers[k] = append(e.subscribers[k], s)
+// Subscribe registers s in PhaseSimulation for messages containing any of
+// the given Kinds. A message matching several of them is delivered only once.
+func (e *Engine) Subscribe(s System, kinds ...Kind) *Subscription {
+	return e.SubscribePhase(PhaseSimulation, s, kinds...)
 }
 
-func (e *Engine) SubscribeFunc(k Kind, f func(Message)) {
-	e.Subscribe(k, SystemFunc(f))
+// SubscribePhase is like Subscribe, but registers s in Phase p.
+func (e *Engine) SubscribePhase(p Phase, s System, kinds ...Kind) *Subscription {
+	return e.subscribe(p, s, kinds, Match{})
 }
 
+// SubscribeMatch registers s in Phase p for all messages matching ma.
+func (e *Engine) SubscribeMatch(p Phase, s System, ma Match) *Subscription {
+	return e.subscribe(p, s, ma.keys(), ma)
+}
+
+func (e *Engine) subscribe(p Phase, s System, kinds []Kind, ma Match) *Subscription {
+	e.Lock()
+	defer e.Unlock()
+
+	e.subscribers.seq++
+	sub := &Subscription{
+		engine:  e,
+		system:  s,
+		handler: chain(e.middleware, s),
+		kinds:   kinds,
+		match:   ma,
+		phase:   p,
+		seq:     e.subscribers.seq,
+	}
+	for _, k := range kinds {
+		e.subscribers.insert(k, sub)
+	}
+	e.all = append(e.all, sub)
+	return sub
+}
+
+func (e *Engine) SubscribeFunc(f func(Message), kinds ...Kind) *Subscription {
+	return e.Subscribe(SystemFunc(f), kinds...)
+}
+
+// Publish enqueues m for delivery to every System subscribed to a Kind
+// contained in m.Flags. It never blocks and never calls a System itself.
+// Messages are delivered in the order they were published, Systems are
+// called by Phase and in the order they subscribed. A message with a
+// payload not matching a bound type is replaced by an Error.
 func (e *Engine) Publish(m Message) {
-	for f, kinds := range e.subscribers {
-		if m.Flags.Contains(f) {
-			for _, h := range kinds {
-				h.Handle(m)
-			}
+	if err := checkPayload(m); err != nil {
+		m = Message{Error, err}
+	}
+
+	e.qmu.Lock()
+	defer e.qmu.Unlock()
+
+	if e.stopped {
+		return
+	}
+	e.queue = append(e.queue, m)
+	if len(e.queue) > e.maxQueued {
+		e.maxQueued = len(e.queue)
+	}
+
+	if e.closed {
+		return
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Post defers m to the next frame. Posted messages are delivered when the
+// next Tick is dispatched, right before the Tick itself, or on Flush, so everything
+// posted during a frame is applied before the systems advance. Messages
+// posted while delivering posted messages are delivered in the same flush,
+// one generation after another, up to maxCascade generations.
+func (e *Engine) Post(m Message) {
+	if err := checkPayload(m); err != nil {
+		m = Message{Error, err}
+	}
+
+	e.qmu.Lock()
+	defer e.qmu.Unlock()
+
+	if e.stopped {
+		return
+	}
+	e.posted = append(e.posted, m)
+}
+
+// Flush delivers the posted messages without a Tick, e.g. once the game
+// stopped ticking. Like Publish it returns before they are delivered.
+func (e *Engine) Flush() {
+	e.Publish(Message{Flags: flushPosted})
+}
+
+// flushPosted is published by Flush, it is not delivered to any System
+var flushPosted = RegisterKind("Flush")
+
+// Close stops the dispatch goroutine after all pending and posted messages
+// have been delivered, including those published by Systems while closing.
+// Messages published after Close returned are dropped. Close must not be
+// called from within a System.
+func (e *Engine) Close() {
+	e.qmu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.wake)
+	}
+	e.qmu.Unlock()
+
+	<-e.done
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+
+	for range e.wake {
+		e.drain()
+	}
+
+	for i := 0; i < maxCascade && e.pending(); i++ {
+		e.drain()
+		e.flush()
+	}
+
+	e.qmu.Lock()
+	e.stopped = true
+	e.queue, e.posted = nil, nil
+	e.qmu.Unlock()
+}
+
+func (e *Engine) pending() bool {
+	e.qmu.Lock()
+	defer e.qmu.Unlock()
+	return len(e.queue) > 0 || len(e.posted) > 0
+}
+
+func (e *Engine) drain() {
+	for {
+		e.qmu.Lock()
+		if len(e.queue) == 0 {
+			e.qmu.Unlock()
+			return
+		}
+		m := e.queue[0]
+		e.queue[0] = Message{}
+		e.queue = e.queue[1:]
+		e.qmu.Unlock()
+
+		if m.Kind(Tick) || m.Kind(flushPosted) {
+			e.flush()
+		}
+		if m.Flags != flushPosted {
+			e.dispatch(m)
+		}
+	}
+}
+
+// maxCascade limits the generations of posted messages delivered in one
+// flush, the rest is carried over to the next frame.
+const maxCascade = 16
+
+func (e *Engine) flush() {
+	for gen := 0; gen < maxCascade; gen++ {
+		e.qmu.Lock()
+		batch := e.posted
+		e.posted = nil
+		e.qmu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+		for _, m := range batch {
+			e.dispatch(m)
 		}
 	}
 }
+
+func (e *Engine) dispatch(m Message) {
+	e.RLock()
+	subs := e.subscribers.match(m.Flags)
+	e.RUnlock()
+
+	for _, s := range subs {
+		if s.cancelled.Load() {
+			continue
+		}
+		e.handle(s, m)
+	}
+}
+
+// handle delivers m to a single Subscription, recovering from panics
+func (e *Engine) handle(s *Subscription, m Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.recovered(s, m, r, debug.Stack())
+		}
+	}()
+
+	if !s.match.accepts(m) {
+		return
+	}
+
+	e.RLock()
+	h := s.handler
+	e.RUnlock()
+
+	start := time.Now()
+	h.Handle(m)
+	s.stats.observe(time.Since(start))
+}
+
+// recovered reports a panic of s as Error and writes its stack to the
+// panic log. After maxFailures panics the Subscription is cancelled.
+func (e *Engine) recovered(s *Subscription, m Message, v interface{}, stack []byte) {
+	s.failures++
+
+	e.RLock()
+	w, max := e.panicLog, e.maxFailures
+	e.RUnlock()
+
+	perr := &PanicError{
+		Value:    v,
+		Stack:    stack,
+		Disabled: max > 0 && s.failures >= max,
+	}
+	if perr.Disabled {
+		s.Cancel()
+	}
+
+	if w != nil {
+		fmt.Fprintf(w, "%v %v handling %v: %v\n%s\n", time.Now().Format(time.RFC3339), s, m.Flags, perr, stack)
+	}
+	e.Publish(Message{Error, &Failure{s.String(), perr, false}})
+}
+
+// SetPanicLog sets the writer the stacks of recovered panics are written to.
+func (e *Engine) SetPanicLog(w io.Writer) {
+	e.Lock()
+	defer e.Unlock()
+	e.panicLog = w
+}
+
+// SetMaxFailures cancels Subscriptions after their System panicked n
+// times, zero never cancels.
+func (e *Engine) SetMaxFailures(n int) {
+	e.Lock()
+	defer e.Unlock()
+	e.maxFailures = n
+}
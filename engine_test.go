@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testInput struct {
+	source, seq int
+}
+
+func TestEngineSerialDelivery(t *testing.T) {
+	const sources, count = 4, 200
+	input := testKinds[0]
+
+	e := NewEngine()
+	var (
+		busy  atomic.Int32
+		last  [sources]int
+		ticks int
+	)
+	serial := func(f func(Message)) System {
+		return SystemFunc(func(m Message) {
+			if busy.Add(1) != 1 {
+				t.Error("systems called concurrently")
+			}
+			f(m)
+			busy.Add(-1)
+		})
+	}
+	e.SubscribePhase(PhaseInput, serial(func(m Message) {
+		in := m.Payload.(testInput)
+		if in.seq != last[in.source]+1 {
+			t.Errorf("source %d: got %d after %d", in.source, in.seq, last[in.source])
+		}
+		last[in.source] = in.seq
+	}), input)
+	e.SubscribePhase(PhaseRender, serial(func(m Message) { ticks++ }), Tick)
+
+	// input from several goroutines while another one ticks
+	var wg sync.WaitGroup
+	for s := 0; s < sources; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 1; i <= count; i++ {
+				e.Publish(Message{input, testInput{s, i}})
+			}
+		}(s)
+	}
+	stop := make(chan struct{})
+	ticked := make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-stop:
+				ticked <- n
+				return
+			default:
+				e.Publish(Message{Tick, time.Now()})
+				n++
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	n := <-ticked
+	e.Close()
+
+	for s, seq := range last {
+		if seq != count {
+			t.Errorf("source %d: delivered %d of %d", s, seq, count)
+		}
+	}
+	if ticks != n {
+		t.Errorf("delivered %d of %d ticks", ticks, n)
+	}
+}
+
+func TestEngineClose(t *testing.T) {
+	ping, pong := testKinds[1], testKinds[2]
+
+	e := NewEngine()
+	var got []int
+	e.SubscribeFunc(func(m Message) {
+		got = append(got, m.Payload.(int))
+		if n := m.Payload.(int); n < 3 {
+			// published and posted while closing
+			e.Publish(Message{pong, n + 10})
+			e.Post(Message{pong, n + 20})
+		}
+	}, ping)
+	e.SubscribeFunc(func(m Message) { got = append(got, m.Payload.(int)) }, pong)
+
+	for i := 0; i < 3; i++ {
+		e.Publish(Message{ping, i})
+	}
+	e.Close()
+	e.Publish(Message{ping, 100})
+	e.Post(Message{ping, 101})
+	e.Close()
+
+	want := []int{0, 1, 2, 10, 11, 12, 20, 21, 22}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if st := e.Stats(); st.Queued != 0 || st.Posted != 0 {
+		t.Errorf("%d queued and %d posted after Close", st.Queued, st.Posted)
+	}
+}
+
+func TestEngineFlush(t *testing.T) {
+	e := NewEngine()
+	done := make(chan struct{})
+	var all int
+	e.SubscribeFunc(func(Message) { all++ }, None)
+	e.SubscribeFunc(func(Message) { close(done) }, Quit)
+
+	e.Post(Message{Flags: Quit})
+	e.Flush()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("posted message not delivered by Flush")
+	}
+	e.Close()
+	if all != 1 {
+		t.Errorf("delivered %d messages, want only the posted one", all)
+	}
+}
+
+func TestEngineCancelDuringDelivery(t *testing.T) {
+	a, b := testKinds[6], testKinds[7]
+
+	e := NewEngine()
+	var self, killer, victim, multi int
+	var selfSub, victimSub, multiSub *Subscription
+	selfSub = e.SubscribeFunc(func(Message) {
+		self++
+		selfSub.Cancel()
+	}, a)
+	e.SubscribeFunc(func(Message) {
+		killer++
+		// both are due for the message being delivered
+		victimSub.Cancel()
+		multiSub.Cancel()
+	}, a)
+	victimSub = e.SubscribeFunc(func(Message) { victim++ }, a)
+	multiSub = e.SubscribeFunc(func(Message) { multi++ }, a, b)
+
+	e.Publish(Message{Flags: a})
+	e.Publish(Message{Flags: b})
+	e.Publish(Message{Flags: Kinds(a, b)})
+	e.Close()
+
+	if self != 1 {
+		t.Errorf("cancelled itself, called %d times, want once", self)
+	}
+	if killer != 2 {
+		t.Errorf("killer called %d times, want 2", killer)
+	}
+	if victim != 0 || multi != 0 {
+		t.Errorf("cancelled during delivery, called %d and %d times, want never", victim, multi)
+	}
+	for _, k := range []Kind{a, b} {
+		for _, s := range e.subscribers.match(k) {
+			if s == selfSub || s == victimSub || s == multiSub {
+				t.Errorf("%v still indexed by a cancelled subscription", k)
+			}
+		}
+	}
+}
+
+func TestEngineMatch(t *testing.T) {
+	a, b, c, d := testKinds[8], testKinds[9], testKinds[10], testKinds[11]
+
+	e := NewEngine()
+	var anyOf, except, where int
+	sub := e.SubscribeMatch(PhaseInput, SystemFunc(func(Message) { anyOf++ }), Match{Any: Kinds(a, b)})
+	// like Mouse but not Remove
+	e.SubscribeMatch(PhaseInput, SystemFunc(func(Message) { except++ }), Match{All: c, Not: d})
+	e.SubscribeMatch(PhaseInput, SystemFunc(func(Message) { where++ }), Match{
+		All:   a,
+		Where: func(m Message) bool { return m.Payload == 1 },
+	})
+
+	e.Publish(Message{Kinds(a, b), 1})
+	e.Publish(Message{a, 2})
+	e.Publish(Message{Flags: c})
+	e.Publish(Message{Flags: Kinds(c, d)})
+	e.Publish(Message{Flags: Kinds(b, c, d)})
+	e.Publish(Message{Flags: d})
+	e.Close()
+
+	if anyOf != 3 {
+		t.Errorf("Any delivered %d messages, want 3, each once", anyOf)
+	}
+	if except != 1 {
+		t.Errorf("Not delivered %d messages, want 1", except)
+	}
+	if where != 1 {
+		t.Errorf("Where delivered %d messages, want 1", where)
+	}
+
+	if len(sub.kinds) != 2 {
+		t.Fatalf("Any of two Kinds is indexed by %v", sub.kinds)
+	}
+	sub.Cancel()
+	for _, k := range sub.kinds {
+		for _, s := range e.subscribers.match(k) {
+			if s == sub {
+				t.Errorf("cancelled subscription still indexed by %v", k)
+			}
+		}
+	}
+}
+
+func TestEngineStats(t *testing.T) {
+	k, later := testKinds[20], testKinds[21]
+
+	e := NewEngine()
+	entered, release := make(chan struct{}), make(chan struct{})
+	e.SubscribePhase(PhaseRender, SystemFunc(func(Message) {}), k).Named("draw")
+	e.SubscribeFunc(func(Message) {}, k).Named("gone").Cancel()
+	e.SubscribePhase(PhaseInput, SystemFunc(func(m Message) {
+		if m.Payload == 0 {
+			close(entered)
+			<-release
+		}
+		time.Sleep(2 * time.Millisecond)
+	}), k).Named("slow")
+
+	e.Publish(Message{k, 0})
+	<-entered
+	for i := 1; i <= 3; i++ {
+		e.Publish(Message{k, i})
+	}
+	e.Post(Message{Flags: later})
+	e.Post(Message{Flags: later})
+	st := e.Stats()
+	if st.Queued != 3 || st.MaxQueued < 3 || st.Posted != 2 {
+		t.Errorf("blocked with %d queued, %d at most and %d posted, want 3, 3 and 2", st.Queued, st.MaxQueued, st.Posted)
+	}
+	close(release)
+	e.Close()
+
+	st = e.Stats()
+	if st.Queued != 0 || st.Posted != 0 || st.MaxQueued < 3 {
+		t.Errorf("closed with %d queued, %d at most and %d posted", st.Queued, st.MaxQueued, st.Posted)
+	}
+	if len(st.Handlers) != 2 {
+		t.Fatalf("got handlers %v, want slow and draw, without the cancelled one", st.Handlers)
+	}
+	slow, draw := st.Handlers[0], st.Handlers[1]
+	if slow.Name != "slow" || draw.Name != "draw" || slow.Phase != PhaseInput || draw.Phase != PhaseRender {
+		t.Errorf("handlers %v are not in order of Phase", st.Handlers)
+	}
+	if slow.Calls != 4 || draw.Calls != 4 {
+		t.Errorf("counted %d and %d calls, want 4", slow.Calls, draw.Calls)
+	}
+	if slow.Max < 2*time.Millisecond || slow.Total < 8*time.Millisecond || slow.Max > slow.Total || slow.Avg() != slow.Total/4 {
+		t.Errorf("slow took %v at most and %v in total", slow.Max, slow.Total)
+	}
+}
+
+func TestEnginePanic(t *testing.T) {
+	k := testKinds[22]
+
+	e := NewEngine()
+	var log strings.Builder
+	e.SetPanicLog(&log)
+	e.SetMaxFailures(3)
+
+	var before, after int
+	var errs []error
+	e.SubscribeFunc(func(Message) { before++ }, k)
+	bad := e.SubscribeFunc(func(Message) { panic("boom") }, k).Named("bad")
+	e.SubscribeFunc(func(Message) { after++ }, k)
+	e.SubscribeFunc(func(m Message) { errs = append(errs, m.Payload.(error)) }, Error)
+
+	for i := 0; i < 5; i++ {
+		e.Publish(Message{Flags: k})
+	}
+	e.Close()
+
+	if before != 5 || after != 5 {
+		t.Errorf("other systems called %d and %d times, want 5", before, after)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("got errors %v, want one per panic until disabled", errs)
+	}
+	for i, err := range errs {
+		var f *Failure
+		var p *PanicError
+		if !errors.As(err, &f) || f.Source != "bad" || !errors.As(err, &p) {
+			t.Fatalf("error %v is not a Failure of bad carrying a PanicError", err)
+		}
+		if p.Value != "boom" || !strings.Contains(string(p.Stack), "engine_test.go") {
+			t.Errorf("panic %v with stack\n%s", p.Value, p.Stack)
+		}
+		if p.Disabled != (i == 2) {
+			t.Errorf("panic %d reported Disabled %v", i+1, p.Disabled)
+		}
+	}
+	if n := strings.Count(log.String(), "handling Test22: panic: boom"); n != 3 || !strings.Contains(log.String(), "engine_test.go") {
+		t.Errorf("panic log has %d panics:\n%s", n, log.String())
+	}
+	for _, s := range e.subscribers.match(k) {
+		if s == bad {
+			t.Error("disabled subscription still indexed")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failure is the structured payload of an Error message.
+type Failure struct {
+	Source string // the part of the game that failed, e.g. "terminal"
+	Err    error
+	Fatal  bool // the game can not continue and has to quit
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%v: %v", f.Source, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// IsFatal reports whether err is or wraps a fatal Failure.
+func IsFatal(err error) bool {
+	var f *Failure
+	return errors.As(err, &f) && f.Fatal
+}
+
+// PanicError is a recovered panic of a System.
+type PanicError struct {
+	Value    interface{}
+	Stack    []byte
+	Disabled bool // the System was unsubscribed after repeated panics
+}
+
+func (p *PanicError) Error() string {
+	if p.Disabled {
+		return fmt.Sprintf("panic: %v (disabled)", p.Value)
+	}
+	return fmt.Sprintf("panic: %v", p.Value)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+var (
+	Zoning = RegisterKind("Zoning") // component, ClickMode of a building
+)
+
+func init() {
+	RegisterComponent[Rect](Geometry)
+	RegisterComponent[ClickMode](Zoning)
+}
+
+// Rect is the footprint of a building in map cells.
+type Rect struct {
+	X, Y, W, H int
+}
+
+func (r Rect) Contains(p Point) bool {
+	return p.X >= r.X && p.Y >= r.Y && p.X < r.X+r.W && p.Y < r.Y+r.H
+}
+
+func (r Rect) Intersects(o Rect) bool {
+	return r.X < o.X+o.W && o.X < r.X+r.W && r.Y < o.Y+o.H && o.Y < r.Y+r.H
+}
+
+// Center returns the center of the footprint in cell coordinates.
+func (r Rect) Center() Vec {
+	return Vec{float64(r.X) + float64(r.W-1)/2, float64(r.Y) + float64(r.H-1)/2}
+}
+
+// Dist returns the distance of p to the nearest cell of the footprint.
+func (r Rect) Dist(p Point) float64 {
+	dx := math.Max(math.Max(float64(r.X-p.X), 0), float64(p.X-(r.X+r.W-1)))
+	dy := math.Max(math.Max(float64(r.Y-p.Y), 0), float64(p.Y-(r.Y+r.H-1)))
+	return math.Hypot(dx, dy)
+}
+
+// footprint sizes, see docs.go
+const (
+	LowBuilding  = 1
+	MidBuilding  = 2
+	HighBuilding = 3
+)
+
+// Levels of a building with a square footprint of the given size,
+// a low building has one level, mid two and high three.
+func Levels(r Rect) int {
+	if r.W < r.H {
+		return r.W
+	}
+	return r.H
+}
+
+// bucketSize is the edge length of a grid bucket in cells
+const bucketSize = 8
+
+// SpatialIndex is a uniform grid of footprints for area and proximity
+// queries. Every entity is listed in all buckets its footprint touches.
+type SpatialIndex struct {
+	buckets map[Point][]Entity
+	rects   map[Entity]Rect
+}
+
+func NewSpatialIndex() *SpatialIndex {
+	return &SpatialIndex{
+		buckets: make(map[Point][]Entity),
+		rects:   make(map[Entity]Rect),
+	}
+}
+
+func bucketOf(x, y int) Point {
+	return Point{floorDiv(x, bucketSize), floorDiv(y, bucketSize)}
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return (a - b + 1) / b
+	}
+	return a / b
+}
+
+// eachBucket calls f for every bucket touched by r
+func (r Rect) eachBucket(f func(Point)) {
+	min, max := bucketOf(r.X, r.Y), bucketOf(r.X+r.W-1, r.Y+r.H-1)
+	for by := min.Y; by <= max.Y; by++ {
+		for bx := min.X; bx <= max.X; bx++ {
+			f(Point{bx, by})
+		}
+	}
+}
+
+func (ix *SpatialIndex) Insert(e Entity, r Rect) {
+	ix.Remove(e)
+	ix.rects[e] = r
+	r.eachBucket(func(b Point) {
+		ix.buckets[b] = append(ix.buckets[b], e)
+	})
+}
+
+func (ix *SpatialIndex) Remove(e Entity) {
+	r, ok := ix.rects[e]
+	if !ok {
+		return
+	}
+	delete(ix.rects, e)
+	r.eachBucket(func(b Point) {
+		es := ix.buckets[b]
+		for i, o := range es {
+			if o == e {
+				es = append(es[:i], es[i+1:]...)
+				break
+			}
+		}
+		if len(es) == 0 {
+			delete(ix.buckets, b)
+		} else {
+			ix.buckets[b] = es
+		}
+	})
+}
+
+// Rect returns the footprint of e.
+func (ix *SpatialIndex) Rect(e Entity) (Rect, bool) {
+	r, ok := ix.rects[e]
+	return r, ok
+}
+
+// Query returns all entities with a footprint intersecting r, in order of creation.
+func (ix *SpatialIndex) Query(r Rect) []Entity {
+	seen := make(map[Entity]bool)
+	var found []Entity
+	r.eachBucket(func(b Point) {
+		for _, e := range ix.buckets[b] {
+			if !seen[e] && ix.rects[e].Intersects(r) {
+				seen[e] = true
+				found = append(found, e)
+			}
+		}
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+	return found
+}
+
+// At returns the entity occupying the cell p.
+func (ix *SpatialIndex) At(p Point) (Entity, bool) {
+	for _, e := range ix.buckets[bucketOf(p.X, p.Y)] {
+		if ix.rects[e].Contains(p) {
+			return e, true
+		}
+	}
+	return 0, false
+}
+
+// Nearest returns the entity closest to p for which accept returns true.
+// Buckets are searched in growing rings around p until no closer
+// footprint can be found.
+func (ix *SpatialIndex) Nearest(p Point, accept func(Entity) bool) (Entity, bool) {
+	if len(ix.rects) == 0 {
+		return 0, false
+	}
+
+	var (
+		best     Entity
+		bestDist = math.Inf(1)
+		center   = bucketOf(p.X, p.Y)
+		checked  = make(map[Entity]bool)
+	)
+
+	// enough rings to cover every bucket in use
+	maxRing := 0
+	for b := range ix.buckets {
+		if d := abs(b.X - center.X); d > maxRing {
+			maxRing = d
+		}
+		if d := abs(b.Y - center.Y); d > maxRing {
+			maxRing = d
+		}
+	}
+
+	for ring := 0; ring <= maxRing; ring++ {
+		// every footprint in outer rings is at least this far away
+		if float64((ring-1)*bucketSize) > bestDist {
+			break
+		}
+
+		for by := center.Y - ring; by <= center.Y+ring; by++ {
+			for bx := center.X - ring; bx <= center.X+ring; bx++ {
+				if bx != center.X-ring && bx != center.X+ring && by != center.Y-ring && by != center.Y+ring {
+					continue // inner rings are done
+				}
+				for _, e := range ix.buckets[Point{bx, by}] {
+					if checked[e] {
+						continue
+					}
+					checked[e] = true
+					if d := ix.rects[e].Dist(p); (d < bestDist || d == bestDist && e < best) && accept(e) {
+						best, bestDist = e, d
+					}
+				}
+			}
+		}
+	}
+
+	return best, !math.IsInf(bestDist, 1)
+}
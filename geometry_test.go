@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSpatialIndexNearest(t *testing.T) {
+	ix := NewSpatialIndex()
+	ix.Insert(1, Rect{0, 0, 3, 3})
+	ix.Insert(2, Rect{20, 20, 2, 2})
+	ix.Insert(3, Rect{-10, 7, 1, 1})
+	ix.Insert(4, Rect{100, 0, 1, 1})
+
+	all := func(Entity) bool { return true }
+	tests := []struct {
+		p      Point
+		accept func(Entity) bool
+		want   Entity
+		ok     bool
+	}{
+		{Point{1, 1}, all, 1, true},
+		{Point{15, 15}, all, 2, true},
+		{Point{-5, 7}, func(e Entity) bool { return e != 1 }, 3, true},
+		{Point{60, 0}, func(e Entity) bool { return e != 1 }, 4, true},
+		{Point{-200, -200}, func(e Entity) bool { return e == 4 }, 4, true},
+		{Point{1, 1}, func(Entity) bool { return false }, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := ix.Nearest(tt.p, tt.accept); got != tt.want || ok != tt.ok {
+			t.Errorf("Nearest(%v) = %v, %v, want %v, %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if _, ok := NewSpatialIndex().Nearest(Point{}, all); ok {
+		t.Error("found an entity in an empty index")
+	}
+}
+
+// Nearest finds the same entity as comparing every footprint
+func TestSpatialIndexNearestBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ix := NewSpatialIndex()
+	rects := make(map[Entity]Rect)
+	for e := Entity(1); e <= 200; e++ {
+		rect := Rect{r.Intn(400) - 200, r.Intn(400) - 200, r.Intn(3) + 1, r.Intn(3) + 1}
+		ix.Insert(e, rect)
+		rects[e] = rect
+	}
+	odd := func(e Entity) bool { return e%2 == 1 }
+
+	for i := 0; i < 500; i++ {
+		p := Point{r.Intn(600) - 300, r.Intn(600) - 300}
+
+		var want Entity
+		best := math.Inf(1)
+		for e, rect := range rects {
+			if d := rect.Dist(p); odd(e) && (d < best || d == best && e < want) {
+				want, best = e, d
+			}
+		}
+
+		if got, _ := ix.Nearest(p, odd); got != want {
+			t.Fatalf("Nearest(%v) = %v at %v, want %v at %v", p, got, rects[got].Dist(p), want, best)
+		}
+	}
+}
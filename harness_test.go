@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+var (
+	Sync = RegisterKind("Sync") // chan struct{} closed once all queued messages are delivered
+)
+
+func init() {
+	BindPayload[chan struct{}](Sync)
+}
+
+// Harness runs a game without a terminal on a MemoryScreen. Every
+// message it publishes is delivered, including the messages published
+// in turn, before the call returns.
+type Harness struct {
+	engine *Engine
+	screen *MemoryScreen
+	state  *GameState
+	ticks  int
+}
+
+// harnessEpoch is the time of the first Tick, so every run is the same
+var harnessEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func NewHarness(width, height int) *Harness {
+	h := &Harness{
+		engine: NewEngine(),
+		screen: NewMemoryScreen(width, height),
+	}
+	h.state = newGame(h.engine, h.screen, DefaultKeymap())
+	h.engine.SubscribePhase(PhaseRender, SystemFunc(h.sync), Sync).Named("sync")
+	return h
+}
+
+// sync closes the channel of a Sync message once nothing is queued behind it
+func (h *Harness) sync(m Message) {
+	if h.engine.Stats().Queued > 0 {
+		h.engine.Publish(m)
+		return
+	}
+	close(m.Payload.(chan struct{}))
+}
+
+// Publish publishes m and waits until it and its consequences are delivered.
+func (h *Harness) Publish(m Message) {
+	h.engine.Publish(m)
+
+	done := make(chan struct{})
+	h.engine.Publish(Message{Sync, done})
+	<-done
+}
+
+func (h *Harness) Key(ke KeyEvent) {
+	h.Publish(Message{Key, ke})
+}
+
+// Type presses the keys of the characters of s.
+func (h *Harness) Type(s string) {
+	for _, ch := range s {
+		if ch == ' ' {
+			h.Key(KeyEvent{Key: termbox.KeySpace})
+		} else {
+			h.Key(KeyEvent{Ch: ch})
+		}
+	}
+}
+
+func (h *Harness) Click(x, y int) {
+	h.Publish(Message{Mouse, MouseEvent{termbox.MouseLeft, x, y}})
+}
+
+// Resize resizes the screen and publishes the Resize a terminal would.
+func (h *Harness) Resize(width, height int) {
+	h.screen.Resize(width, height)
+	h.Publish(Message{Resize, Point{width, height}})
+}
+
+// Tick advances the game by n frames.
+func (h *Harness) Tick(n int) {
+	for i := 0; i < n; i++ {
+		h.ticks++
+		h.Publish(Message{Tick, harnessEpoch.Add(time.Duration(h.ticks) * time.Second / 70)})
+	}
+}
+
+func (h *Harness) Close() {
+	h.engine.Close()
+}
+
+// colorCodes are the letters backgrounds are shown as by Frame
+var colorCodes = map[Color]byte{
+	ColorDefault: '.',
+	ColorBlack:   'k',
+	ColorRed:     'r',
+	ColorGreen:   'g',
+	ColorYellow:  'y',
+	ColorBlue:    'b',
+	ColorMagenta: 'm',
+	ColorCyan:    'c',
+	ColorWhite:   'w',
+}
+
+// Frame returns the last flushed frame as text: the characters, followed
+// by the backgrounds as one letter per cell. While the engine stats are
+// shown, their digits are replaced by #, they depend on timing.
+func (h *Harness) Frame() string {
+	var b strings.Builder
+	width, height := h.screen.Size()
+	text := h.screen.Text()
+	if h.state.debug {
+		text = maskStats(text, width-14)
+	}
+	b.WriteString(text)
+
+	b.WriteByte('\n')
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			_, _, bg := h.screen.Cell(x, y)
+			c, ok := colorCodes[bg]
+			if !ok {
+				c = '?'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// statsNumber is a number of the stats panel with the padding in front
+var statsNumber = regexp.MustCompile(`[ 0-9]*[0-9]`)
+
+// maskStats replaces the numbers of every line of text from column x on
+// by #, so their width does not matter either
+func maskStats(text string, x int) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		rs := []rune(l)
+		if len(rs) > x {
+			lines[i] = string(rs[:x]) + statsNumber.ReplaceAllString(string(rs[x:]), "#")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunScript plays a script and returns the frames it captured. A script
+// has one command per line, empty lines and lines starting with # are
+// ignored:
+//
+//	size W H     start a game on a W x H screen, must be first
+//	resize W H   resize the screen
+//	key NAME     press a key named like in keymaps, e.g. F2, Esc, a or Alt+a
+//	type TEXT    press the keys of the characters of TEXT
+//	click X Y    click the left mouse button
+//	tick N       advance N frames
+//	frame        capture the last flushed frame
+func RunScript(r io.Reader) (string, error) {
+	var (
+		h   *Harness
+		out strings.Builder
+		sc  = bufio.NewScanner(r)
+		n   int
+	)
+	defer func() {
+		if h != nil {
+			h.Close()
+		}
+	}()
+
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		args := make([]int, 0, 2)
+		for _, f := range fields[1:] {
+			if i, err := strconv.Atoi(f); err == nil {
+				args = append(args, i)
+			}
+		}
+		want := map[string]int{"size": 2, "resize": 2, "click": 2, "tick": 1}[fields[0]]
+		if len(args) != want && fields[0] != "key" && fields[0] != "type" {
+			return "", fmt.Errorf("line %d: %q needs %d numbers", n, fields[0], want)
+		}
+		if h == nil && fields[0] != "size" {
+			return "", fmt.Errorf("line %d: script does not start with size", n)
+		}
+
+		switch fields[0] {
+		case "size":
+			if h != nil {
+				return "", fmt.Errorf("line %d: size twice", n)
+			}
+			h = NewHarness(args[0], args[1])
+		case "resize":
+			h.Resize(args[0], args[1])
+		case "key":
+			ke, err := ParseKey(strings.Join(fields[1:], " "))
+			if err != nil {
+				return "", fmt.Errorf("line %d: %v", n, err)
+			}
+			h.Key(ke)
+		case "type":
+			h.Type(strings.TrimSpace(strings.TrimPrefix(line, "type")))
+		case "click":
+			h.Click(args[0], args[1])
+		case "tick":
+			h.Tick(args[0])
+		case "frame":
+			fmt.Fprintf(&out, "-- line %d\n%s", n, h.Frame())
+		default:
+			return "", fmt.Errorf("line %d: unknown command %q", n, fields[0])
+		}
+	}
+	return out.String(), sc.Err()
+}
+
+// update writes the golden files instead of comparing them
+var update = flag.Bool("update", false, "write the golden files of TestGolden")
+
+// TestGolden runs the scripts in testdata and compares their frames to
+// the golden files next to them, with the extension .golden instead of
+// .script. With -update the golden files are written instead.
+func TestGolden(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/*.script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no scripts in testdata")
+	}
+
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".script")
+		t.Run(name, func(t *testing.T) {
+			golden := strings.TrimSuffix(script, ".script") + ".golden"
+
+			f, err := os.Open(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := RunScript(f)
+			f.Close()
+			if err != nil {
+				t.Fatalf("%v: %v", script, err)
+			}
+
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line, ok := firstDiff(want, []byte(got)); !ok {
+				t.Errorf("%v differs from %v at line %d, run with -update to accept", script, golden, line)
+			}
+		})
+	}
+}
+
+// firstDiff returns the first line, counted from 1, where a and b differ
+func firstDiff(a, b []byte) (int, bool) {
+	if bytes.Equal(a, b) {
+		return 0, true
+	}
+	al, bl := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	for i := range al {
+		if i >= len(bl) || !bytes.Equal(al[i], bl[i]) {
+			return i + 1, false
+		}
+	}
+	return len(al) + 1, false
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// action is something the player does with a key
+type action struct {
+	name string // e.g. tool.residential
+	help string
+	run  func(gs *GameState)
+}
+
+// actions in the order they are listed in the help
+var actions = []action{
+	{"tool.idle", "inspect without zoning", func(gs *GameState) { gs.setMode(ModeIdle) }},
+	{"tool.residential", "zone residential", func(gs *GameState) { gs.setMode(ModeResidential) }},
+	{"tool.commercial", "zone commercial", func(gs *GameState) { gs.setMode(ModeCommercial) }},
+	{"tool.industrial", "zone industrial", func(gs *GameState) { gs.setMode(ModeIndustrial) }},
+	{"tool.delete", "demolish buildings", func(gs *GameState) { gs.setMode(ModeDelete) }},
+	{"tool.size", "cycle building size", func(gs *GameState) { gs.setSize(gs.size%HighBuilding + 1) }},
+	{"game.pause", "pause or resume", func(gs *GameState) { gs.setPaused(!gs.paused) }},
+	{"game.speed", "cycle speed 1x 2x 4x", func(gs *GameState) {
+		speed := gs.speed * 2
+		if speed > 4 {
+			speed = 1
+		}
+		gs.setSpeed(speed)
+	}},
+	{"game.save", "save to " + defaultSave, func(gs *GameState) { gs.saveGame(defaultSave) }},
+	{"game.load", "load from " + defaultSave, func(gs *GameState) { gs.loadGame(defaultSave) }},
+	{"game.cast", "start or stop casting", func(gs *GameState) { gs.engine.Publish(Message{Flags: Cast}) }},
+	{"game.command", "open the command line", func(gs *GameState) {
+		gs.prompt = true
+		gs.command = gs.command[:0]
+	}},
+	{"game.quit", "quit", func(gs *GameState) { gs.quit() }},
+	{"view.help", "show this help", func(gs *GameState) { gs.help = true }},
+	{"view.debug", "show engine stats", func(gs *GameState) { gs.debug = !gs.debug }},
+}
+
+func lookupAction(name string) (action, bool) {
+	for _, a := range actions {
+		if a.name == name {
+			return a, true
+		}
+	}
+	return action{}, false
+}
+
+// Keymap binds keys to the names of actions.
+type Keymap map[KeyEvent]string
+
+// defaultBindings are the keys of the actions unless a keymap file
+// rebinds them
+var defaultBindings = map[string][]string{
+	"tool.idle":        {"F1"},
+	"tool.residential": {"F2", "r"},
+	"tool.commercial":  {"F3", "c"},
+	"tool.industrial":  {"F4", "i"},
+	"tool.delete":      {"F5", "d"},
+	"tool.size":        {"F7", "s"},
+	"game.pause":       {"Space"},
+	"game.speed":       {"F6", "+"},
+	"game.save":        {"F9"},
+	"game.load":        {"F10"},
+	"game.cast":        {"F8"},
+	"game.command":     {":"},
+	"game.quit":        {"Esc"},
+	"view.help":        {"?", "F11"},
+	"view.debug":       {"F12"},
+}
+
+// DefaultKeymap returns the default bindings.
+func DefaultKeymap() Keymap {
+	km, err := bindKeys(defaultBindings)
+	if err != nil {
+		panic(err)
+	}
+	return km
+}
+
+// LoadKeymap reads a keymap file overriding the default bindings. The file
+// is a JSON object of action names and their keys, e.g.
+//
+//	{"tool.residential": ["F2", "Alt+r"], "game.cast": []}
+//
+// The keys of an action in the file replace all of its default keys, an
+// empty list unbinds the action. A missing file is no error, keys bound
+// to more than one action are.
+func LoadKeymap(path string) (Keymap, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultKeymap(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var user map[string][]string
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	bindings := make(map[string][]string)
+	for name, keys := range defaultBindings {
+		bindings[name] = keys
+	}
+	for name, keys := range user {
+		bindings[name] = keys
+	}
+
+	km, err := bindKeys(bindings)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return km, nil
+}
+
+// bindKeys builds a Keymap, reporting unknown actions, invalid keys and
+// all conflicts
+func bindKeys(bindings map[string][]string) (Keymap, error) {
+	km := make(Keymap)
+	var errs []string
+
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := lookupAction(name); !ok {
+			errs = append(errs, fmt.Sprintf("unknown action %q", name))
+			continue
+		}
+		for _, key := range bindings[name] {
+			ke, err := ParseKey(key)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%v: %v", name, err))
+				continue
+			}
+			if other, ok := km[ke]; ok && other != name {
+				errs = append(errs, fmt.Sprintf("%v is bound to %v and %v", KeyName(ke), other, name))
+				continue
+			}
+			km[ke] = name
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return km, nil
+}
+
+// Keys returns the names of the keys bound to the action, sorted.
+func (km Keymap) Keys(name string) []string {
+	var keys []string
+	for ke, a := range km {
+		if a == name {
+			keys = append(keys, KeyName(ke))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		// named keys before characters
+		if ci, cj := len([]rune(keys[i])) == 1, len([]rune(keys[j])) == 1; ci != cj {
+			return cj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// keyNames of the keys without a character. Backspace is the code most
+// terminals send, the one of some others is Ctrl+H and named so.
+var keyNames = []struct {
+	name string
+	key  termbox.Key
+}{
+	{"Esc", termbox.KeyEsc}, {"Enter", termbox.KeyEnter}, {"Tab", termbox.KeyTab},
+	{"Backspace", termbox.KeyBackspace2},
+	{"Space", termbox.KeySpace}, {"Insert", termbox.KeyInsert}, {"Delete", termbox.KeyDelete},
+	{"Home", termbox.KeyHome}, {"End", termbox.KeyEnd}, {"PgUp", termbox.KeyPgup}, {"PgDn", termbox.KeyPgdn},
+	{"Up", termbox.KeyArrowUp}, {"Down", termbox.KeyArrowDown},
+	{"Left", termbox.KeyArrowLeft}, {"Right", termbox.KeyArrowRight},
+	{"F1", termbox.KeyF1}, {"F2", termbox.KeyF2}, {"F3", termbox.KeyF3}, {"F4", termbox.KeyF4},
+	{"F5", termbox.KeyF5}, {"F6", termbox.KeyF6}, {"F7", termbox.KeyF7}, {"F8", termbox.KeyF8},
+	{"F9", termbox.KeyF9}, {"F10", termbox.KeyF10}, {"F11", termbox.KeyF11}, {"F12", termbox.KeyF12},
+}
+
+// ParseKey parses the name of a key as formatted by KeyName, e.g. F2, r,
+// Alt+r or Ctrl+S. Modifiers are not case sensitive, characters are.
+func ParseKey(name string) (KeyEvent, error) {
+	var ke KeyEvent
+	rest := name
+	for {
+		mod, after, ok := strings.Cut(rest, "+")
+		if !ok || after == "" {
+			break
+		}
+		switch strings.ToLower(mod) {
+		case "alt":
+			ke.Mod |= ModAlt
+		case "ctrl":
+			r := []rune(strings.ToLower(after))
+			if len(r) != 1 || r[0] < 'a' || r[0] > 'z' {
+				return ke, fmt.Errorf("invalid key %q, Ctrl combines with a letter", name)
+			}
+			ke.Key = termbox.KeyCtrlA + termbox.Key(r[0]-'a')
+			return ke, nil
+		default:
+			return ke, fmt.Errorf("invalid key %q, unknown modifier %q", name, mod)
+		}
+		rest = after
+	}
+
+	for _, kn := range keyNames {
+		if strings.EqualFold(kn.name, rest) {
+			ke.Key = kn.key
+			return ke, nil
+		}
+	}
+	if r := []rune(rest); len(r) == 1 && r[0] > ' ' {
+		ke.Ch = r[0]
+		return ke, nil
+	}
+	return ke, fmt.Errorf("invalid key %q", name)
+}
+
+// KeyName formats ke, it is the inverse of ParseKey.
+func KeyName(ke KeyEvent) string {
+	var name string
+	switch {
+	case ke.Key == 0:
+		name = string(ke.Ch)
+	case ke.Key >= termbox.KeyCtrlA && ke.Key <= termbox.KeyCtrlZ && !namedKey(ke.Key):
+		name = "Ctrl+" + string(rune('A'+ke.Key-termbox.KeyCtrlA))
+	default:
+		name = fmt.Sprintf("Key(%d)", ke.Key)
+		for _, kn := range keyNames {
+			if kn.key == ke.Key {
+				name = kn.name
+				break
+			}
+		}
+	}
+
+	if ke.Mod&ModAlt != 0 {
+		name = "Alt+" + name
+	}
+	return name
+}
+
+func namedKey(k termbox.Key) bool {
+	for _, kn := range keyNames {
+		if kn.key == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+// testKeymap writes a keymap file and loads it
+func testKeymap(t *testing.T, data string) (Keymap, error) {
+	path := filepath.Join(t.TempDir(), "keymap.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadKeymap(path)
+}
+
+func TestLoadKeymapMissing(t *testing.T) {
+	km, err := LoadKeymap(filepath.Join(t.TempDir(), "keymap.json"))
+	if err != nil || !reflect.DeepEqual(km, DefaultKeymap()) {
+		t.Errorf("missing file = %v, %v, want the default keymap", km, err)
+	}
+}
+
+func TestLoadKeymap(t *testing.T) {
+	km, err := testKeymap(t, `{"tool.residential": ["Alt+r", "Ctrl+R"], "game.cast": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := km.Keys("tool.residential"), []string{"Alt+r", "Ctrl+R"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("overridden keys %v, want %v", got, want)
+	}
+	if _, ok := km[KeyEvent{Key: termbox.KeyF2}]; ok {
+		t.Error("default key of an overridden action still bound")
+	}
+	if keys := km.Keys("game.cast"); len(keys) != 0 {
+		t.Errorf("unbound action has keys %v", keys)
+	}
+	if got := km.Keys("tool.size"); !reflect.DeepEqual(got, []string{"F7", "s"}) {
+		t.Errorf("other actions keep their defaults, got %v", got)
+	}
+}
+
+func TestLoadKeymapErrors(t *testing.T) {
+	tests := []struct {
+		data, err string
+	}{
+		{`{"tool.nope": ["x"]}`, `unknown action "tool.nope"`},
+		{`{"tool.size": ["Bogus+q"]}`, `unknown modifier "Bogus"`},
+		{`{"tool.size": ["Ctrl+1"]}`, `invalid key "Ctrl+1"`},
+		{`{"tool.size": ["PageUp"]}`, `invalid key "PageUp"`},
+		{`{"tool.size": ["r"]}`, "r is bound to tool.residential and tool.size"},
+		{`{"tool.size": "s"}`, "keymap.json"},
+	}
+	for _, tt := range tests {
+		if _, err := testKeymap(t, tt.data); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want %q", tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestKeyNames(t *testing.T) {
+	for name, keys := range defaultBindings {
+		for _, key := range keys {
+			ke, err := ParseKey(key)
+			if err != nil || KeyName(ke) != key {
+				t.Errorf("%v: ParseKey(%q) = %v, %v, formatted as %q", name, key, ke, err, KeyName(ke))
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		ke   KeyEvent
+	}{
+		{"Backspace", KeyEvent{Key: termbox.KeyBackspace2}},
+		{"Ctrl+H", KeyEvent{Key: termbox.KeyBackspace}},
+		{"Alt+Enter", KeyEvent{Key: termbox.KeyEnter, Mod: ModAlt}},
+		{"Ctrl+S", KeyEvent{Key: termbox.KeyCtrlS}},
+		{"Alt++", KeyEvent{Ch: '+', Mod: ModAlt}},
+		{"a", KeyEvent{Ch: 'a'}},
+	}
+	for _, tt := range tests {
+		ke, err := ParseKey(tt.name)
+		if err != nil || ke != tt.ke {
+			t.Errorf("ParseKey(%q) = %v, %v, want %v", tt.name, ke, err, tt.ke)
+		}
+		if got := KeyName(tt.ke); got != tt.name {
+			t.Errorf("KeyName(%v) = %q, want %q", tt.ke, got, tt.name)
+		}
+	}
+}
@@ -1,33 +1,216 @@
 package main
 
-type Kind uint32
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kind is a set of flags. Every registered Kind is a single flag, sets
+// are built with Or. The set grows with the number of registered flags.
+type Kind struct {
+	bits string // little endian, without trailing zero bytes
+}
+
+// None is the empty Kind, it is contained in every Kind
+var None Kind
+
+var registry struct {
+	sync.Mutex
+	names  []string
+	byName map[string]Kind
+}
+
+// RegisterKind returns a new single flag Kind. It is meant to be called
+// while initializing package variables and panics on duplicate names.
+func RegisterKind(name string) Kind {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.byName[name]; ok {
+		panic("kind " + name + " already registered")
+	}
+	if strings.ContainsAny(name, "|# ") || name == "" || name == "None" {
+		panic(fmt.Sprintf("invalid kind name %q", name))
+	}
+	if registry.byName == nil {
+		registry.byName = make(map[string]Kind)
+	}
+
+	k := singleKind(len(registry.names))
+	registry.names = append(registry.names, name)
+	registry.byName[name] = k
+	return k
+}
+
+// singleKind returns the Kind with only the i-th flag set
+func singleKind(i int) Kind {
+	b := make([]byte, i/8+1)
+	b[i/8] = 1 << uint(i%8)
+	return Kind{string(b)}
+}
+
+// LookupKind returns the registered Kind with the given name.
+func LookupKind(name string) (Kind, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	k, ok := registry.byName[name]
+	return k, ok
+}
+
+// Kinds returns the union of ks.
+func Kinds(ks ...Kind) Kind {
+	var r Kind
+	for _, k := range ks {
+		r = r.Or(k)
+	}
+	return r
+}
+
+func (a Kind) at(i int) byte {
+	if i < len(a.bits) {
+		return a.bits[i]
+	}
+	return 0
+}
+
+func (a Kind) Or(b Kind) Kind {
+	if len(a.bits) < len(b.bits) {
+		a, b = b, a
+	}
+	if len(b.bits) == 0 {
+		return a
+	}
+
+	r := []byte(a.bits)
+	for i := 0; i < len(b.bits); i++ {
+		r[i] |= b.bits[i]
+	}
+	return Kind{string(r)}
+}
+
+func (a Kind) AndNot(b Kind) Kind {
+	r := []byte(a.bits)
+	for i := range r {
+		r[i] &^= b.at(i)
+	}
+	for len(r) > 0 && r[len(r)-1] == 0 {
+		r = r[:len(r)-1]
+	}
+	return Kind{string(r)}
+}
 
 func (a Kind) Contains(b Kind) bool {
-	return b&^a == 0
+	for i := 0; i < len(b.bits); i++ {
+		if b.bits[i]&^a.at(i) != 0 {
+			return false
+		}
+	}
+	return true
 }
 
 func (a Kind) Intersects(b Kind) bool {
-	return b&a > 0
+	for i := 0; i < len(b.bits); i++ {
+		if b.bits[i]&a.at(i) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Kind) IsZero() bool {
+	return len(a.bits) == 0
+}
+
+// Len is the number of flags up to and including the highest one set.
+func (a Kind) Len() int {
+	if len(a.bits) == 0 {
+		return 0
+	}
+	n := (len(a.bits) - 1) * 8
+	for b := a.bits[len(a.bits)-1]; b != 0; b >>= 1 {
+		n++
+	}
+	return n
+}
+
+// Has reports whether the i-th flag is set.
+func (a Kind) Has(i int) bool {
+	return a.at(i/8)&(1<<uint(i%8)) != 0
+}
+
+// String formats the set as its names joined by |, e.g. Key|Mouse.
+// Flags without a registered name are shown as their index.
+func (a Kind) String() string {
+	if a.IsZero() {
+		return "None"
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	var names []string
+	for i, n := 0, a.Len(); i < n; i++ {
+		if !a.Has(i) {
+			continue
+		}
+		if i < len(registry.names) {
+			names = append(names, registry.names[i])
+		} else {
+			names = append(names, fmt.Sprintf("#%d", i))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (a Kind) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Kind) UnmarshalText(text []byte) error {
+	k, err := ParseKind(string(text))
+	if err != nil {
+		return err
+	}
+	*a = k
+	return nil
+}
+
+// ParseKind is the inverse of Kind.String.
+func ParseKind(s string) (Kind, error) {
+	var r Kind
+	if s == "None" {
+		return r, nil
+	}
+
+	for _, name := range strings.Split(s, "|") {
+		k, ok := LookupKind(name)
+		if !ok {
+			return None, fmt.Errorf("unknown kind %q", name)
+		}
+		r = r.Or(k)
+	}
+	return r, nil
 }
 
-const (
+var (
 	// process
-	Tick Kind = 1 << iota
-	Quit
-	Error
+	Tick  = RegisterKind("Tick")
+	Quit  = RegisterKind("Quit")
+	Error = RegisterKind("Error")
 
 	// input
-	Resize
-	Key
-	Mouse
+	Resize = RegisterKind("Resize")
+	Key    = RegisterKind("Key")
+	Mouse  = RegisterKind("Mouse")
 
 	// entity
-	Add
-	Update
-	Remove
+	Add    = RegisterKind("Add")
+	Update = RegisterKind("Update")
+	Remove = RegisterKind("Remove")
 
 	// components
-	Position
-	Velocity
-	Geometry
+	Position = RegisterKind("Position")
+	Velocity = RegisterKind("Velocity")
+	Geometry = RegisterKind("Geometry")
 )
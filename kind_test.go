@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestKindSets(t *testing.T) {
+	lo, hi := testKind(8), testKind(64)
+
+	tests := []struct {
+		a, b       Kind
+		or, andNot Kind
+		contains   bool
+		intersects bool
+	}{
+		{None, None, None, None, true, false},
+		{Tick, None, Tick, Tick, true, false},
+		{None, Tick, Tick, None, false, false},
+		{Tick, Kinds(Tick, Key), Kinds(Tick, Key), None, false, true},
+		{Kinds(Tick, Key), Key, Kinds(Tick, Key), Tick, true, true},
+		{Tick, lo, Kinds(Tick, lo), Tick, false, false},
+		{Kinds(Tick, hi), hi, Kinds(Tick, hi), Tick, true, true},
+		{hi, Tick, Kinds(Tick, hi), hi, false, false},
+		{Kinds(lo, hi), Kinds(lo, hi), Kinds(lo, hi), None, true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Or(tt.b); got != tt.or {
+			t.Errorf("%v.Or(%v) = %v, want %v", tt.a, tt.b, got, tt.or)
+		}
+		if got := tt.a.AndNot(tt.b); got != tt.andNot {
+			t.Errorf("%v.AndNot(%v) = %v, want %v", tt.a, tt.b, got, tt.andNot)
+		}
+		if got := tt.a.Contains(tt.b); got != tt.contains {
+			t.Errorf("%v.Contains(%v) = %v, want %v", tt.a, tt.b, got, tt.contains)
+		}
+		if got := tt.a.Intersects(tt.b); got != tt.intersects {
+			t.Errorf("%v.Intersects(%v) = %v, want %v", tt.a, tt.b, got, tt.intersects)
+		}
+	}
+}
+
+func TestKindLen(t *testing.T) {
+	hi := testKind(64)
+	if hi.Len() <= 64 || !hi.Has(hi.Len()-1) || hi.Has(hi.Len()) || hi.Has(0) {
+		t.Errorf("%v has Len %d", hi, hi.Len())
+	}
+	if n := None.Len(); n != 0 {
+		t.Errorf("None has Len %d", n)
+	}
+}
+
+func TestKindString(t *testing.T) {
+	tests := []struct {
+		k Kind
+		s string
+	}{
+		{None, "None"},
+		{Tick, "Tick"},
+		{Kinds(Key, Tick), "Tick|Key"},
+		{testKinds[0], "Test0"},
+		{Kinds(testKinds[79], Quit, testKinds[9]), "Quit|Test9|Test79"},
+	}
+	for _, tt := range tests {
+		if got := tt.k.String(); got != tt.s {
+			t.Errorf("String() = %q, want %q", got, tt.s)
+		}
+		k, err := ParseKind(tt.s)
+		if err != nil || k != tt.k {
+			t.Errorf("ParseKind(%q) = %v, %v, want %v", tt.s, k, err, tt.k)
+		}
+	}
+
+	if s := singleKind(1000).String(); s != "#1000" {
+		t.Errorf("unregistered flag is %q", s)
+	}
+	for _, s := range []string{"", "Nope", "Tick|", "Tick|Nope", "#1000"} {
+		if k, err := ParseKind(s); err == nil {
+			t.Errorf("ParseKind(%q) = %v, want an error", s, k)
+		}
+	}
+}
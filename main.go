@@ -1,31 +1,167 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sync"
 	"time"
 )
 
+var (
+	recordPath = flag.String("record", "", "record the session to `file`")
+	replayPath = flag.String("replay", "", "replay a recorded session from `file`")
+	logPath    = flag.String("log", "gophercity.log", "write panics of systems to `file`")
+	loadPath   = flag.String("load", "", "load a saved game from `file`")
+	castPath   = flag.String("cast", "gophercity.cast", "cast the screen to `file`, numbered if it exists, started and stopped with F8")
+	castMax    = flag.Int64("cast-max", 10<<20, "stop casting when the cast reaches `bytes`, zero never stops")
+	httpAddr   = flag.String("http", "", "play in a browser at `address`, e.g. localhost:8070, instead of the terminal")
+	httpPublic = flag.Bool("http-public", false, "allow -http on other than loopback addresses, anyone reaching it can play")
+	keysPath   = flag.String("keys", "gophercity.keys", "read the key bindings from `file`, a JSON object of actions and their keys")
+)
+
+// maxFailures of a system before it is disabled
+const maxFailures = 5
+
 func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run plays until Quit. It returns the fatal error that caused the Quit,
+// if any, after the terminal has been restored.
+func run() error {
 	engine := NewEngine()
+	engine.SetMaxFailures(maxFailures)
+
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		engine.SetPanicLog(f)
+	}
+
+	keymap, err := LoadKeymap(*keysPath)
+	if err != nil {
+		return err
+	}
+
+	var replay *Replay
+	if *replayPath != "" {
+		var err error
+		if replay, err = LoadReplay(engine, *replayPath); err != nil {
+			return err
+		}
+	}
+
+	var frontend Frontend
+	if *httpAddr != "" {
+		web, err := NewWeb(engine, *httpAddr, *httpPublic)
+		if err != nil {
+			return err
+		}
+		frontend = web
+	} else {
+		frontend = NewTerminal(engine)
+	}
+	engine.SubscribePhase(PhaseRender, frontend, Quit).Named("term")
+
+	if replay != nil {
+		frontend.SetPassive(true)
+	}
 
-	terminal := NewTerminal(engine)
-	engine.Subscribe(Quit, terminal)
+	if *recordPath != "" {
+		w, h := frontend.Size()
+		recorder, err := NewRecorder(*recordPath, w, h)
+		if err != nil {
+			frontend.Handle(Message{Flags: Quit})
+			return err
+		}
+		engine.SubscribePhase(PhaseInput, recorder, RecordKinds...).Named("record")
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
 
-	state := NewGameState(engine, terminal)
-	engine.Subscribe(Key, state)
-	engine.Subscribe(Resize, state)
-	engine.Subscribe(Mouse, state)
-	engine.Subscribe(Tick, state)
-	engine.Subscribe(Quit, state)
+	caster := NewCaster(engine, frontend, *castPath, *castMax)
+	engine.SubscribePhase(PhaseRender, caster, Cast, Quit).Named("cast")
+
+	newGame(engine, caster, keymap)
+
+	if *loadPath != "" {
+		engine.Publish(Message{Load, *loadPath})
+	}
+
+	// written by the engine, read after it is closed
+	var fatal []error
+	engine.SubscribeFunc(func(m Message) {
+		if err := m.Payload.(error); IsFatal(err) {
+			fatal = append(fatal, err)
+		}
+	}, Error).Named("fatal")
+
+	quit := make(chan struct{})
+	var once sync.Once
+	engine.SubscribePhase(PhaseRender, SystemFunc(func(Message) {
+		once.Do(func() { close(quit) })
+	}), Quit).Named("quit")
 
 	var (
-		update = time.Tick(time.Duration(1000/70) * time.Millisecond)
-		now    time.Time
+		frames   = time.Tick(time.Duration(1000/70) * time.Millisecond)
+		now      time.Time
+		replayed bool
 	)
 
-	for state.Running() {
+	for {
 		select {
-		case now = <-update:
-			engine.Publish(Message{Tick, now})
+		case now = <-frames:
+			switch {
+			case replay == nil:
+				engine.Publish(Message{Tick, now})
+			case replayed:
+				// keep the last frame until Esc, without ticks posted
+				// messages like the Quit after a fatal Error need a Flush
+				engine.Flush()
+			default:
+				replayed = !replay.Step()
+			}
+		case <-quit:
+			engine.Close()
+			return errors.Join(fatal...)
 		}
 	}
 }
+
+// newGame subscribes the systems of a new game drawn on screen and played
+// with the keys of keymap.
+func newGame(engine *Engine, screen Screen, keymap Keymap) *GameState {
+	scheduler := NewScheduler(engine)
+	engine.SubscribePhase(PhaseInput, scheduler, Schedule, Speed, Tick, Save, Restore).Named("clock")
+
+	world := NewWorld(engine)
+	engine.SubscribePhase(PhaseInput, world, Save, Restore).Named("world")
+	engine.SubscribePhase(PhaseSimulation, NewMovement(world, scheduler), Tick, Restore).Named("move")
+	engine.SubscribePhase(PhaseSimulation, NewEconomy(engine, world), Workday, Kinds(Add, Zoning), Kinds(Remove, Zoning), Kinds(Remove, Route), Save, Restore).Named("economy")
+
+	state := NewGameState(engine, screen, world, scheduler)
+	state.SetKeymap(keymap)
+	engine.SubscribePhase(PhaseInput, state, Key, Resize, Mouse, Inspect, Status, Error, Quit).Named("input")
+	engine.SubscribePhase(PhaseSimulation, SystemFunc(state.advance), Tick).Named("sim")
+	engine.SubscribePhase(PhasePostSimulation, state, Save, Restore).Named("state")
+	engine.SubscribePhase(PhaseRender, state, Tick).Named("draw")
+
+	// every system fills its section of a Save before it is written
+	saver := NewSaver(engine)
+	engine.SubscribePhase(PhaseInput, saver, Load).Named("load")
+	engine.SubscribePhase(PhaseRender, saver, Save).Named("save")
+
+	return state
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Middleware wraps the delivery of a message to a System. It may inspect,
+// alter or drop the message, or run code around the call of next.
+type Middleware func(next System) System
+
+// Use appends mw to the middleware chain of the Engine. Middleware is
+// applied in the order it was added, the first one being the outermost.
+// The chain is built once per Subscription, so a Middleware may keep state
+// for the System it wraps; Use rebuilds the chains of all Subscriptions,
+// dropping that state.
+func (e *Engine) Use(mw ...Middleware) {
+	e.Lock()
+	defer e.Unlock()
+	e.middleware = append(e.middleware[:len(e.middleware):len(e.middleware)], mw...)
+	for _, s := range e.all {
+		s.handler = chain(e.middleware, s.system)
+	}
+}
+
+func chain(mw []Middleware, s System) System {
+	for i := len(mw) - 1; i >= 0; i-- {
+		s = mw[i](s)
+	}
+	return s
+}
+
+// Filter drops every message for which keep returns false.
+func Filter(keep func(Message) bool) Middleware {
+	return func(next System) System {
+		return SystemFunc(func(m Message) {
+			if keep(m) {
+				next.Handle(m)
+			}
+		})
+	}
+}
+
+// Trace logs every delivery with the receiving System and its duration.
+func Trace(l *log.Logger) Middleware {
+	return func(next System) System {
+		return SystemFunc(func(m Message) {
+			start := time.Now()
+			next.Handle(m)
+			l.Printf("%T %v %v", next, m.Flags, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestMiddlewareChain(t *testing.T) {
+	input := testKinds[3]
+
+	e := NewEngine()
+	var built, seen int
+	count := func(next System) System {
+		built++
+		n := 0
+		return SystemFunc(func(m Message) {
+			// state of the wrapped System survives between messages
+			n++
+			seen = n
+			next.Handle(m)
+		})
+	}
+	var got []int
+	e.SubscribeFunc(func(m Message) { got = append(got, m.Payload.(int)) }, input)
+	e.Use(count, Filter(func(m Message) bool { return m.Payload.(int)%2 == 0 }))
+
+	for i := 0; i < 5; i++ {
+		e.Publish(Message{input, i})
+	}
+	e.Close()
+
+	if built != 1 {
+		t.Errorf("middleware built %d times, want once", built)
+	}
+	if seen != 5 {
+		t.Errorf("middleware saw %d messages, want 5", seen)
+	}
+	if len(got) != 3 || got[0] != 0 || got[1] != 2 || got[2] != 4 {
+		t.Errorf("filtered to %v, want [0 2 4]", got)
+	}
+}
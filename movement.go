@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+)
+
+// Vec is a position or velocity on the map, in cells and cells per game tick.
+type Vec struct {
+	X, Y float64
+}
+
+func (a Vec) Add(b Vec) Vec       { return Vec{a.X + b.X, a.Y + b.Y} }
+func (a Vec) Sub(b Vec) Vec       { return Vec{a.X - b.X, a.Y - b.Y} }
+func (a Vec) Scale(f float64) Vec { return Vec{a.X * f, a.Y * f} }
+func (a Vec) Dot(b Vec) float64   { return a.X*b.X + a.Y*b.Y }
+func (a Vec) Len() float64        { return math.Hypot(a.X, a.Y) }
+
+// Cell returns the map cell containing a
+func (a Vec) Cell() (x, y int) {
+	return int(math.Floor(a.X + 0.5)), int(math.Floor(a.Y + 0.5))
+}
+
+// Towards returns the velocity moving from a to b at speed
+func (a Vec) Towards(b Vec, speed float64) Vec {
+	d := b.Sub(a)
+	if l := d.Len(); l > 0 {
+		return d.Scale(speed / l)
+	}
+	return Vec{}
+}
+
+var (
+	Route = RegisterKind("Route") // component, the Trip of a commuting gopher
+)
+
+func init() {
+	RegisterComponent[Vec](Position)
+	RegisterComponent[Vec](Velocity)
+	RegisterComponent[Trip](Route)
+}
+
+// Trip leads from home to work and back.
+type Trip struct {
+	Home, Work Vec
+	Returning  bool
+}
+
+// Movement is a System advancing every entity with a Position and
+// Velocity by the game time passed on Tick. Entities on a Route turn around at
+// work and are destroyed when they are back home.
+type Movement struct {
+	world *World
+	clock *Scheduler
+	date  Date
+}
+
+func NewMovement(w *World, clock *Scheduler) *Movement {
+	return &Movement{
+		world: w,
+		clock: clock,
+	}
+}
+
+func (mv *Movement) Handle(m Message) {
+	if m.Kind(Restore) {
+		mv.date = m.Payload.(*SaveState).Clock.Date
+		return
+	}
+	if !m.Kind(Tick) {
+		return
+	}
+
+	date := mv.clock.Date()
+	dt := float64(date - mv.date)
+	mv.date = date
+	if dt <= 0 {
+		return
+	}
+
+	w := mv.world
+	for _, e := range w.Query(Position.Or(Velocity)) {
+		p, _ := Get[Vec](w, e, Position)
+		v, _ := Get[Vec](w, e, Velocity)
+		next := p.Add(v.Scale(dt))
+
+		if t, ok := Get[Trip](w, e, Route); ok {
+			goal := t.Work
+			if t.Returning {
+				goal = t.Home
+			}
+
+			// passed the goal if it is behind the next position
+			if goal.Sub(next).Dot(v) <= 0 {
+				if t.Returning {
+					w.Destroy(e)
+					continue
+				}
+				t.Returning = true
+				Set(w, e, Route, t)
+				Set(w, e, Velocity, goal.Towards(t.Home, v.Len()))
+				next = goal
+			}
+		}
+
+		Set(w, e, Position, next)
+	}
+}
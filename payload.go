@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// payloads binds Kinds to the type of their payload
+var payloads struct {
+	sync.RWMutex
+	types map[Kind]reflect.Type
+}
+
+func init() {
+	BindPayload[time.Time](Tick)
+	BindPayload[error](Error)
+	BindPayload[Point](Resize)
+	BindPayload[KeyEvent](Key)
+	BindPayload[MouseEvent](Mouse)
+}
+
+// PayloadError reports a message published with a payload not matching
+// the type bound to one of its Kinds.
+type PayloadError struct {
+	Kind Kind
+	Want reflect.Type
+	Got  reflect.Type // nil for a missing payload
+}
+
+func (e *PayloadError) Error() string {
+	got := "no payload"
+	if e.Got != nil {
+		got = e.Got.String()
+	}
+	return fmt.Sprintf("payload of %v must be %v, got %v", e.Kind, e.Want, got)
+}
+
+// BindPayload binds the single flag Kind k to payloads of type T. Binding
+// a Kind to another type than before panics.
+func BindPayload[T any](k Kind) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	payloads.Lock()
+	defer payloads.Unlock()
+
+	if payloads.types == nil {
+		payloads.types = make(map[Kind]reflect.Type)
+	}
+	if b, ok := payloads.types[k]; ok && b != t {
+		panic(fmt.Sprintf("kind %v already bound to %v", k, b))
+	}
+	payloads.types[k] = t
+}
+
+// checkPayload validates the payload of m against all bound Kinds of its
+// flags, in flag order, so the first mismatching Kind is reported.
+func checkPayload(m Message) error {
+	payloads.RLock()
+	defer payloads.RUnlock()
+
+	for i, n := 0, m.Flags.Len(); i < n; i++ {
+		if !m.Flags.Has(i) {
+			continue
+		}
+		k := singleKind(i)
+		t, ok := payloads.types[k]
+		if !ok {
+			continue
+		}
+		if m.Payload == nil {
+			return &PayloadError{k, t, nil}
+		}
+		if got := reflect.TypeOf(m.Payload); !got.AssignableTo(t) {
+			return &PayloadError{k, t, got}
+		}
+	}
+	return nil
+}
+
+// boundPayload returns the payload type bound to the first bound flag.
+func boundPayload(flags Kind) (reflect.Type, bool) {
+	payloads.RLock()
+	defer payloads.RUnlock()
+
+	for i, n := 0, flags.Len(); i < n; i++ {
+		if !flags.Has(i) {
+			continue
+		}
+		if t, ok := payloads.types[singleKind(i)]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Subscribe registers f in Phase p for messages containing k. The payload
+// type of k is bound to T, so f is only called with valid payloads.
+func Subscribe[T any](e *Engine, p Phase, k Kind, f func(T)) *Subscription {
+	BindPayload[T](k)
+
+	return e.SubscribePhase(p, SystemFunc(func(m Message) {
+		if v, ok := m.Payload.(T); ok {
+			f(v)
+		}
+	}), k)
+}
+
+// Publish publishes v with Kind k, after checking it against the bound
+// payload types.
+func Publish[T any](e *Engine, k Kind, v T) error {
+	m := Message{k, v}
+	if err := checkPayload(m); err != nil {
+		return err
+	}
+	e.Publish(m)
+	return nil
+}
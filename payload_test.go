@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSubscribePayload(t *testing.T) {
+	count := testKinds[12]
+
+	e := NewEngine()
+	var got []int
+	Subscribe(e, PhaseInput, count, func(n int) { got = append(got, n) })
+	var errs []error
+	e.SubscribeFunc(func(m Message) { errs = append(errs, m.Payload.(error)) }, Error)
+
+	if err := Publish(e, count, 1); err != nil {
+		t.Errorf("Publish of a bound type: %v", err)
+	}
+	err := Publish(e, count, "two")
+	var pe *PayloadError
+	if !errors.As(err, &pe) || pe.Kind != count || pe.Want != reflect.TypeOf(0) || pe.Got != reflect.TypeOf("") {
+		t.Errorf("Publish of another type = %v, want a *PayloadError", err)
+	}
+	e.Publish(Message{count, "three"})
+	e.Post(Message{Flags: count})
+	e.Flush()
+	e.Close()
+
+	if !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("delivered %v, want only the valid payload", got)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v, want one for Publish and one for Post", errs)
+	}
+	for i, want := range []reflect.Type{reflect.TypeOf(""), nil} {
+		if !errors.As(errs[i], &pe) || pe.Kind != count || pe.Got != want {
+			t.Errorf("error %d is %v, want a *PayloadError for %v", i, errs[i], want)
+		}
+	}
+}
+
+func TestCheckPayloadOrder(t *testing.T) {
+	name, size := testKinds[13], testKinds[14]
+	BindPayload[string](name)
+	BindPayload[int](size)
+
+	tests := []struct {
+		payload any
+		kind    Kind
+	}{
+		{1.5, name},
+		{"x", size},
+		{1, name},
+	}
+	for _, tt := range tests {
+		// the map of bound types must not decide which Kind is reported
+		for i := 0; i < 20; i++ {
+			var pe *PayloadError
+			err := checkPayload(Message{Kinds(size, name), tt.payload})
+			if !errors.As(err, &pe) || pe.Kind != tt.kind {
+				t.Fatalf("payload %v reported as %v, want %v", tt.payload, err, tt.kind)
+			}
+		}
+	}
+}
+
+func TestBindPayloadTwice(t *testing.T) {
+	k := testKinds[15]
+	BindPayload[int](k)
+	BindPayload[int](k)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("binding another type did not panic")
+		}
+	}()
+	BindPayload[string](k)
+}
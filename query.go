@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrTimeout = errors.New("query timed out")
+
+// Query is the payload of a request message. The first System answering
+// it with Reply wins, later replies are ignored.
+type Query struct {
+	Request interface{}
+
+	once  sync.Once
+	reply chan interface{}
+}
+
+func NewQuery(req interface{}) *Query {
+	return &Query{
+		Request: req,
+		reply:   make(chan interface{}, 1),
+	}
+}
+
+// Reply answers the query, it reports whether this was the first reply.
+func (q *Query) Reply(v interface{}) bool {
+	answered := false
+	q.once.Do(func() {
+		q.reply <- v
+		answered = true
+	})
+	return answered
+}
+
+// Ask publishes a query with Kind k and waits up to timeout for the reply.
+// Ask must not be called from within a System, the query would only be
+// delivered after the System returned.
+func (e *Engine) Ask(k Kind, req interface{}, timeout time.Duration) (interface{}, error) {
+	q := NewQuery(req)
+	e.Publish(Message{k, q})
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case v := <-q.reply:
+		return v, nil
+	case <-t.C:
+		return nil, fmt.Errorf("%v: %w", k, ErrTimeout)
+	}
+}
+
+// Ask is the typed variant of Engine.Ask.
+func Ask[Resp any](e *Engine, k Kind, req interface{}, timeout time.Duration) (Resp, error) {
+	var r Resp
+	v, err := e.Ask(k, req, timeout)
+	if err != nil {
+		return r, err
+	}
+
+	r, ok := v.(Resp)
+	if !ok {
+		return r, fmt.Errorf("%v: reply must be %T, got %T", k, r, v)
+	}
+	return r, nil
+}
+
+// Answer registers f in Phase p as responder to queries of Kind k.
+// Queries with a request not of type Req are left for other responders.
+func Answer[Req, Resp any](e *Engine, p Phase, k Kind, f func(Req) Resp) *Subscription {
+	BindPayload[*Query](k)
+
+	return e.SubscribePhase(p, SystemFunc(func(m Message) {
+		q := m.Payload.(*Query)
+		if req, ok := q.Request.(Req); ok {
+			q.Reply(f(req))
+		}
+	}), k)
+}
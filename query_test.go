@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestAsk(t *testing.T) {
+	double := testKinds[16]
+
+	e := NewEngine()
+	defer e.Close()
+	Answer(e, PhaseInput, double, func(n int) int { return 2 * n })
+
+	n, err := Ask[int](e, double, 21, time.Second)
+	if err != nil || n != 42 {
+		t.Errorf("Ask = %d, %v, want 42", n, err)
+	}
+}
+
+func TestAskFirstReply(t *testing.T) {
+	k := testKinds[17]
+
+	e := NewEngine()
+	Answer(e, PhaseInput, k, func(int) string { return "first" })
+	late := make(chan bool, 1)
+	e.SubscribePhase(PhaseRender, SystemFunc(func(m Message) {
+		late <- m.Payload.(*Query).Reply("second")
+	}), k)
+
+	s, err := Ask[string](e, k, 0, time.Second)
+	e.Close()
+	if err != nil || s != "first" {
+		t.Errorf("Ask = %q, %v, want the first reply", s, err)
+	}
+	if <-late {
+		t.Error("a later Reply reported it answered")
+	}
+}
+
+func TestAskReplyType(t *testing.T) {
+	k := testKinds[18]
+
+	e := NewEngine()
+	defer e.Close()
+	Answer(e, PhaseInput, k, func(int) string { return "text" })
+
+	_, err := Ask[int](e, k, 0, time.Second)
+	if err == nil || errors.Is(err, ErrTimeout) {
+		t.Errorf("Ask of a mistyped reply = %v, want a type error", err)
+	}
+}
+
+func TestAnswerRequestType(t *testing.T) {
+	k := testKinds[19]
+
+	e := NewEngine()
+	defer e.Close()
+	called := false
+	Answer(e, PhaseInput, k, func(int) int { called = true; return 0 })
+
+	_, err := Ask[int](e, k, "not an int", 10*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Ask of an unanswered request = %v, want ErrTimeout", err)
+	}
+	e.Close()
+	if called {
+		t.Error("responder called with a request of another type")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	h := NewHarness(40, 12)
+	defer h.Close()
+	h.Key(KeyEvent{Key: termbox.KeyF2})
+	h.Click(1, 1)
+	h.Tick(1)
+
+	c, err := Ask[Cell](h.engine, Inspect, Point{1, 1}, time.Second)
+	ch, fg, bg := h.screen.Cell(1, 1)
+	if err != nil || c.Ch != ch || c.Fg != fg || c.Bg != bg || bg == ColorDefault {
+		t.Errorf("Inspect of a building = %q on %v, %v, want %q on %v", c.Ch, c.Bg, err, ch, bg)
+	}
+	c, err = Ask[Cell](h.engine, Inspect, Point{-1, 100}, time.Second)
+	if err != nil || c.Ch != ' ' {
+		t.Errorf("Inspect out of bounds = %q, %v, want an empty cell", c.Ch, err)
+	}
+}
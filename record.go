@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/nsf/termbox-go"
+)
+
+// RecordKinds are recorded by a Recorder. Only input is recorded, every
+// other message is derived from it and will be published again on replay.
+// Payloads are encoded as JSON and restored as the type bound to their
+// Kind with BindPayload, the type name is kept to detect old recordings.
+var RecordKinds = []Kind{Tick, Key, Mouse, Resize}
+
+type record struct {
+	Tick    int             `json:"tick"`
+	Flags   Kind            `json:"flags"`
+	Type    string          `json:"type,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func encodeRecord(tick int, m Message) (record, error) {
+	r := record{
+		Tick:  tick,
+		Flags: m.Flags,
+	}
+	if m.Payload == nil {
+		return r, nil
+	}
+
+	t, ok := boundPayload(m.Flags)
+	if !ok {
+		return r, fmt.Errorf("no payload type bound to %v", m.Flags)
+	}
+	r.Type = t.String()
+
+	var err error
+	r.Payload, err = json.Marshal(m.Payload)
+	return r, err
+}
+
+func (r record) decode() (Message, error) {
+	m := Message{Flags: r.Flags}
+	if r.Type == "" {
+		return m, nil
+	}
+
+	// recorded before keys carried characters and modifiers
+	if r.Type == "termbox.Key" {
+		var k termbox.Key
+		if err := json.Unmarshal(r.Payload, &k); err != nil {
+			return m, fmt.Errorf("payload %v: %v", r.Type, err)
+		}
+		m.Payload = KeyEvent{Key: k}
+		return m, nil
+	}
+
+	t, ok := boundPayload(r.Flags)
+	if !ok {
+		return m, fmt.Errorf("no payload type bound to %v", r.Flags)
+	}
+	if r.Type != t.String() {
+		return m, fmt.Errorf("payload of %v must be %v, recorded %v", r.Flags, t, r.Type)
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(r.Payload, v.Interface()); err != nil {
+		return m, fmt.Errorf("payload %v: %v", r.Type, err)
+	}
+	m.Payload = v.Elem().Interface()
+	return m, nil
+}
+
+// Recorder is a System writing every message of RecordKinds to a file,
+// one JSON record per line, tagged with the number of the current tick.
+type Recorder struct {
+	file *os.File
+	out  *bufio.Writer
+	enc  *json.Encoder
+	tick int
+	err  error
+}
+
+// NewRecorder creates the file at path. The initial terminal size is
+// recorded as a Resize, so a replay starts with the same screen.
+func NewRecorder(path string, width, height int) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		file: f,
+		out:  bufio.NewWriter(f),
+	}
+	r.enc = json.NewEncoder(r.out)
+
+	r.Handle(Message{Resize, Point{width, height}})
+	return r, r.err
+}
+
+func (r *Recorder) Handle(m Message) {
+	if r.err != nil {
+		return
+	}
+
+	if m.Kind(Tick) {
+		r.tick++
+	}
+
+	rec, err := encodeRecord(r.tick, m)
+	if err == nil {
+		err = r.enc.Encode(rec)
+	}
+	r.err = err
+}
+
+// Close flushes and closes the file, returning the first error that
+// occurred while recording.
+func (r *Recorder) Close() error {
+	if err := r.out.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Replay feeds a recorded session back through an Engine.
+type Replay struct {
+	engine   *Engine
+	messages []Message
+}
+
+func LoadReplay(e *Engine, path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &Replay{
+		engine: e,
+	}
+
+	var last int
+	dec := json.NewDecoder(f)
+	for line := 1; ; line++ {
+		var rec record
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: record %v: %v", path, line, err)
+		}
+
+		if rec.Tick < last {
+			return nil, fmt.Errorf("%v: record %v: tick %v after %v", path, line, rec.Tick, last)
+		}
+		last = rec.Tick
+
+		m, err := rec.decode()
+		if err != nil {
+			return nil, fmt.Errorf("%v: record %v: %v", path, line, err)
+		}
+		r.messages = append(r.messages, m)
+	}
+
+	return r, nil
+}
+
+// Step publishes the recorded messages of the next tick, up to and
+// including its Tick. It returns false once the recording is exhausted.
+func (r *Replay) Step() bool {
+	for len(r.messages) > 0 {
+		m := r.messages[0]
+		r.messages = r.messages[1:]
+
+		r.engine.Publish(m)
+		if m.Kind(Tick) {
+			break
+		}
+	}
+	return len(r.messages) > 0
+}
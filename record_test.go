@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Tick, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Key, KeyEvent{Key: termbox.KeyF2}},
+		{Key, KeyEvent{Ch: 'r', Mod: ModAlt}},
+		{Mouse, MouseEvent{termbox.MouseLeft, 3, 4}},
+		{Resize, Point{80, 24}},
+		{Flags: Quit},
+	}
+	for _, m := range messages {
+		rec, err := encodeRecord(1, m)
+		if err != nil {
+			t.Fatalf("encode %v: %v", m.Flags, err)
+		}
+		data, _ := json.Marshal(rec)
+		var back record
+		if err := json.Unmarshal(data, &back); err != nil {
+			t.Fatal(err)
+		}
+		got, err := back.decode()
+		if err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("%s decoded to %v, want %v", data, got, m)
+		}
+	}
+
+	if _, err := encodeRecord(1, Message{testKinds[4], 1}); err == nil {
+		t.Error("encoded a payload without a bound type")
+	}
+}
+
+func TestRecordDecode(t *testing.T) {
+	tests := []struct {
+		line string
+		want Message
+		ok   bool
+	}{
+		{`{"tick":1,"flags":"Key","type":"termbox.Key","payload":65534}`, Message{Key, KeyEvent{Key: termbox.KeyF2}}, true},
+		{`{"tick":1,"flags":"Key","type":"main.Point","payload":{"X":1,"Y":2}}`, Message{}, false},
+		{`{"tick":1,"flags":"Test4","type":"int","payload":1}`, Message{}, false},
+		{`{"tick":1,"flags":"Mouse","type":"main.MouseEvent","payload":[]}`, Message{}, false},
+	}
+	for _, tt := range tests {
+		var rec record
+		if err := json.Unmarshal([]byte(tt.line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		got, err := rec.decode()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v", tt.line, err)
+		} else if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s decoded to %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	Save    = RegisterKind("Save")    // *SaveState, filled by all systems, then written
+	Load    = RegisterKind("Load")    // string path of a save file to read
+	Restore = RegisterKind("Restore") // *SaveState read from a save file
+)
+
+func init() {
+	BindPayload[*SaveState](Save)
+	BindPayload[string](Load)
+	BindPayload[*SaveState](Restore)
+}
+
+// defaultSave is the file saved to and loaded from by the game keys
+const defaultSave = "gophercity.save"
+
+// saveVersion is the version of the save format written. Every change of
+// the format increments it and adds a migration from the previous version.
+const saveVersion = 1
+
+// migrations upgrade the decoded state of version v to v+1, indexed by v
+var migrations = map[int]func(state map[string]interface{}) error{}
+
+// saveFile is the envelope of a save, the checksum is the SHA-256 of State
+type saveFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	State    json.RawMessage `json:"state"`
+}
+
+// SaveState is the complete game, every system saves and restores its section.
+type SaveState struct {
+	Path string `json:"-"`
+
+	Clock   *ClockState   `json:"clock"`
+	Game    *GameSave     `json:"game"`
+	World   *WorldState   `json:"world"`
+	Economy *EconomyState `json:"economy"`
+}
+
+// Saver is a System writing a SaveState after all systems filled it
+// and reading save files on Load, publishing them as Restore.
+type Saver struct {
+	engine *Engine
+}
+
+func NewSaver(e *Engine) *Saver {
+	return &Saver{
+		engine: e,
+	}
+}
+
+func (sv *Saver) Handle(m Message) {
+	switch {
+	case m.Kind(Save):
+		st := m.Payload.(*SaveState)
+		if err := WriteSave(st.Path, st); err != nil {
+			sv.engine.Publish(Message{Error, &Failure{"save", err, false}})
+			return
+		}
+		sv.engine.Publish(Message{Status, "saved " + st.Path})
+
+	case m.Kind(Load):
+		path := m.Payload.(string)
+		st, err := ReadSave(path)
+		if err != nil {
+			sv.engine.Publish(Message{Error, &Failure{"load", err, false}})
+			return
+		}
+		sv.engine.Publish(Message{Restore, st})
+	}
+}
+
+// WriteSave writes st to path, replacing the file only after it has
+// been written completely.
+func WriteSave(path string, st *SaveState) error {
+	if err := st.validate(); err != nil {
+		return err
+	}
+
+	state, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(state)
+
+	data, err := json.MarshalIndent(saveFile{
+		Version:  saveVersion,
+		Checksum: hex.EncodeToString(sum[:]),
+		State:    state,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSave reads, verifies and migrates the save file at path.
+func ReadSave(path string) (*SaveState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := decodeSave(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	st.Path = path
+	return st, nil
+}
+
+func decodeSave(data []byte) (*SaveState, error) {
+	var f saveFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("corrupt at byte %d: %v", se.Offset, err)
+		}
+		return nil, fmt.Errorf("corrupt: %v", err)
+	}
+
+	switch {
+	case f.Version <= 0:
+		return nil, fmt.Errorf("missing version")
+	case f.Version > saveVersion:
+		return nil, fmt.Errorf("version %d is newer than supported version %d", f.Version, saveVersion)
+	}
+
+	// the checksum covers the state exactly as written
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, f.State); err != nil {
+		return nil, fmt.Errorf("corrupt state: %v", err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	if hex.EncodeToString(sum[:]) != f.Checksum {
+		return nil, fmt.Errorf("checksum mismatch, the file is corrupt or was edited")
+	}
+
+	state := compact.Bytes()
+	if f.Version < saveVersion {
+		var err error
+		if state, err = migrate(f.Version, state); err != nil {
+			return nil, err
+		}
+	}
+
+	st := &SaveState{}
+	dec := json.NewDecoder(bytes.NewReader(state))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(st); err != nil {
+		return nil, fmt.Errorf("invalid state: %v", err)
+	}
+	if err := st.validate(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// migrate upgrades state from version to saveVersion, one version at a time.
+func migrate(version int, state []byte) ([]byte, error) {
+	var generic map[string]interface{}
+	if err := json.Unmarshal(state, &generic); err != nil {
+		return nil, fmt.Errorf("corrupt state: %v", err)
+	}
+
+	for v := version; v < saveVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d", v)
+		}
+		if err := m(generic); err != nil {
+			return nil, fmt.Errorf("migrating version %d: %v", v, err)
+		}
+	}
+	return json.Marshal(generic)
+}
+
+// validate checks the sections and the references between them
+func (st *SaveState) validate() error {
+	switch {
+	case st.Clock == nil:
+		return fmt.Errorf("missing clock")
+	case st.Game == nil:
+		return fmt.Errorf("missing game")
+	case st.World == nil:
+		return fmt.Errorf("missing world")
+	case st.Economy == nil:
+		return fmt.Errorf("missing economy")
+	}
+
+	g := st.Game
+	if g.Width < 0 || g.Height < 0 || len(g.Cells) != g.Width*g.Height {
+		return fmt.Errorf("game: %d cells do not fill a %dx%d map", len(g.Cells), g.Width, g.Height)
+	}
+
+	masks, stores, err := st.World.decode()
+	if err != nil {
+		return fmt.Errorf("world: %v", err)
+	}
+	zoned := make(map[Entity]ClickMode)
+	if s, ok := stores[Zoning].(*store[ClickMode]); ok {
+		zoned = s.data
+	}
+	footprints := make(map[Entity]Rect)
+	if s, ok := stores[Geometry].(*store[Rect]); ok {
+		footprints = s.data
+	}
+	commuters := make(map[Entity]bool)
+	for e, mask := range masks {
+		if mask.Contains(Route) {
+			commuters[e] = true
+		}
+	}
+	return st.Economy.validate(zoned, footprints, commuters)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testState is a valid state of a single residential with one gopher
+const testState = `{
+	"clock": {"date": 70, "speed": 1},
+	"game": {"width": 1, "height": 1, "cells": [{"Ch": 32, "Fg": 0, "Bg": 3, "Start": 0}],
+		"mode": 1, "size": 1, "console": "", "speed": 1, "paused": false},
+	"world": {"last": 1, "entities": [
+		{"id": 1, "components": {"Geometry": {"X": 0, "Y": 0, "W": 1, "H": 1}, "Zoning": 1}}
+	]},
+	"economy": {"gophers": [{"name": "Klas", "worked": false, "shopped": false, "happiness": 0.5}],
+		"buildings": [{"entity": 1, "members": [0]}], "named": 1}
+}`
+
+// saveEnvelope wraps state like WriteSave does
+func saveEnvelope(version int, state string) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(state)); err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	return fmt.Sprintf(`{"version": %d, "checksum": %q, "state": %s}`, version, hex.EncodeToString(sum[:]), state)
+}
+
+func TestDecodeSave(t *testing.T) {
+	edit := func(old, new string) string {
+		if !strings.Contains(testState, old) {
+			panic("test state does not contain " + old)
+		}
+		return saveEnvelope(1, strings.Replace(testState, old, new, 1))
+	}
+
+	tests := []struct {
+		name string
+		data string
+		err  string // empty if valid
+	}{
+		{"valid", saveEnvelope(1, testState), ""},
+		{"truncated", saveEnvelope(1, testState)[:40], "corrupt at byte"},
+		{"not an object", `[1, 2]`, "corrupt"},
+		{"no version", `{"checksum": "", "state": {}}`, "missing version"},
+		{"version 0", saveEnvelope(0, testState), "missing version"},
+		{"newer", saveEnvelope(2, testState), "version 2 is newer than supported version 1"},
+		{"edited", strings.Replace(saveEnvelope(1, testState), "Klas", "Knut", 1), "checksum mismatch"},
+		{"unknown field", edit(`"named": 1`, `"named": 1, "taxes": 3`), "invalid state"},
+		{"missing section", edit(`"clock": {"date": 70, "speed": 1},`, ``), "missing clock"},
+		{"cells", edit(`"width": 1`, `"width": 2`), "1 cells do not fill a 2x1 map"},
+		{"unknown component", edit(`"Zoning": 1`, `"Zoning": 1, "Taxes": 3`), `unknown component "Taxes"`},
+		{"entity range", edit(`"last": 1`, `"last": 0`), "entity 1 out of range"},
+		{"not zoned", edit(`"entity": 1`, `"entity": 2`), "building 2 is not zoned"},
+		{"duplicated", edit(`{"entity": 1, "members": [0]}`, `{"entity": 1, "members": [0]}, {"entity": 1, "members": []}`), "building 1 is duplicated"},
+		{"no gopher", edit(`"members": [0]`, `"members": [0, 1]`), "no gopher 1"},
+		{"over capacity", edit(`"members": [0]`, `"members": [0, 0, 0, 0, 0]`), "capacity is 4"},
+		{"homeless", edit(`"members": [0]`, `"members": []`), "gopher 0 lives in 0 buildings"},
+		{"commuter", edit(`"happiness": 0.5`, `"happiness": 0.5, "commute": 1`), "gopher 0 commutes as 1"},
+	}
+	for _, tt := range tests {
+		st, err := decodeSave([]byte(tt.data))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%v: %v", tt.name, err)
+		case tt.err == "" && (st.Economy.Gophers[0].Name != "Klas" || st.Clock.Date != 70):
+			t.Errorf("%v: decoded %+v", tt.name, st)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%v: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// version 0 counted the clock in days
+	migrations[0] = func(state map[string]interface{}) error {
+		clock, ok := state["clock"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("no clock")
+		}
+		clock["date"] = clock["day"].(float64) * float64(TicksPerDay)
+		delete(clock, "day")
+		return nil
+	}
+	defer delete(migrations, 0)
+
+	old := strings.Replace(testState, `"date": 70`, `"day": 2`, 1)
+	data, err := migrate(0, []byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st SaveState
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Clock.Date != Days(2) || st.validate() != nil {
+		t.Errorf("migrated to %+v", st.Clock)
+	}
+
+	if _, err := migrate(0, []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "migrating version 0: no clock") {
+		t.Errorf("got %v, want the error of the migration", err)
+	}
+	if _, err := migrate(-1, []byte(testState)); err == nil || !strings.Contains(err.Error(), "no migration from version -1") {
+		t.Errorf("got %v, want a missing migration", err)
+	}
+}
+
+func TestWriteSave(t *testing.T) {
+	want, err := decodeSave([]byte(saveEnvelope(1, testState)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.save")
+	if err := WriteSave(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadSave(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Path = ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %+v, want %+v", got, want)
+	}
+
+	// an invalid state leaves the file alone
+	before, _ := os.ReadFile(path)
+	if err := WriteSave(path, &SaveState{}); err == nil {
+		t.Error("wrote an invalid state")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("invalid state replaced the file")
+	}
+}
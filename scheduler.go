@@ -0,0 +1,171 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync/atomic"
+)
+
+// Date is a point in game time, counted in game ticks. The game clock
+// advances with every Tick by the current speed and stands still while
+// the game is paused.
+type Date int64
+
+const TicksPerDay Date = 70
+
+func Days(n int) Date {
+	return Date(n) * TicksPerDay
+}
+
+func (d Date) Day() int {
+	return int(d / TicksPerDay)
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("day %d", d.Day())
+}
+
+var (
+	Schedule = RegisterKind("Schedule") // *Timer to schedule
+	Speed    = RegisterKind("Speed")    // int game ticks per Tick, 0 pauses
+)
+
+func init() {
+	BindPayload[*Timer](Schedule)
+	BindPayload[int](Speed)
+}
+
+// Timer publishes its Message at a game date, once or repeatedly.
+// It is scheduled by publishing it as a Schedule message.
+type Timer struct {
+	Message Message
+	At      Date // absolute date, used if After is zero
+	After   Date // relative to the date the timer is scheduled
+	Every   Date // interval of repetition, zero fires only once
+
+	seq       uint64
+	cancelled atomic.Bool
+}
+
+// After returns a Timer publishing m in d game ticks.
+func After(d Date, m Message) *Timer {
+	return &Timer{Message: m, After: d}
+}
+
+// Every returns a Timer publishing m every d game ticks, starting in d.
+func Every(d Date, m Message) *Timer {
+	return &Timer{Message: m, After: d, Every: d}
+}
+
+// At returns a Timer publishing m at date d.
+func At(d Date, m Message) *Timer {
+	return &Timer{Message: m, At: d}
+}
+
+// Cancel stops the Timer, it may be called from any goroutine.
+func (t *Timer) Cancel() {
+	t.cancelled.Store(true)
+}
+
+// Scheduler is a System keeping the game clock. It publishes the messages
+// of scheduled Timers when their date is reached. It advances the clock
+// on Tick in PhaseInput, Systems simulating the game time passed subscribe
+// to Tick in a later Phase and read the clock with Date, so every frame is
+// drawn after the simulation caught up.
+type Scheduler struct {
+	engine *Engine
+	date   Date
+	speed  int
+	seq    uint64
+	timers timerQueue
+}
+
+func NewScheduler(e *Engine) *Scheduler {
+	return &Scheduler{
+		engine: e,
+		speed:  1,
+	}
+}
+
+// Date returns the current game date.
+func (s *Scheduler) Date() Date {
+	return s.date
+}
+
+func (s *Scheduler) Handle(m Message) {
+	switch {
+	case m.Kind(Schedule):
+		t := m.Payload.(*Timer)
+		if t.After != 0 {
+			t.At = s.date + t.After
+		}
+		s.seq++
+		t.seq = s.seq
+		heap.Push(&s.timers, t)
+
+	case m.Kind(Speed):
+		s.speed = m.Payload.(int)
+
+	case m.Kind(Save):
+		m.Payload.(*SaveState).Clock = &ClockState{s.date, s.speed}
+
+	case m.Kind(Restore):
+		st := m.Payload.(*SaveState).Clock
+		// pending timers keep their distance to the date
+		for _, t := range s.timers {
+			t.At += st.Date - s.date
+		}
+		s.date, s.speed = st.Date, st.Speed
+
+	case m.Kind(Tick):
+		if s.speed <= 0 {
+			return
+		}
+		for i := 0; i < s.speed; i++ {
+			s.date++
+			s.fire()
+		}
+	}
+}
+
+// ClockState is the saved game clock.
+type ClockState struct {
+	Date  Date `json:"date"`
+	Speed int  `json:"speed"`
+}
+
+func (s *Scheduler) fire() {
+	for len(s.timers) > 0 && s.timers[0].At <= s.date {
+		t := heap.Pop(&s.timers).(*Timer)
+		if t.cancelled.Load() {
+			continue
+		}
+
+		s.engine.Publish(t.Message)
+		if t.Every > 0 {
+			t.At += t.Every
+			heap.Push(&s.timers, t)
+		}
+	}
+}
+
+// timerQueue is a heap of Timers ordered by date and scheduling order
+type timerQueue []*Timer
+
+func (q timerQueue) Len() int { return len(q) }
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].At != q[j].At {
+		return q[i].At < q[j].At
+	}
+	return q[i].seq < q[j].seq
+}
+func (q timerQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *timerQueue) Push(x interface{}) { *q = append(*q, x.(*Timer)) }
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerTick(t *testing.T) {
+	fired := testKinds[5]
+
+	e := NewEngine()
+	s := NewScheduler(e)
+	e.SubscribePhase(PhaseInput, s, Schedule, Speed, Tick)
+
+	var got []string
+	log := func(what string) System {
+		return SystemFunc(func(m Message) {
+			got = append(got, fmt.Sprintf("%v %d", what, s.Date()))
+		})
+	}
+	e.SubscribePhase(PhaseRender, log("render"), Tick)
+	e.SubscribePhase(PhaseSimulation, log("sim"), Tick)
+	timers := 0
+	e.SubscribeFunc(func(Message) { timers++ }, fired)
+
+	tick := func() { e.Publish(Message{Tick, time.Time{}}) }
+	e.Publish(Message{Schedule, Every(2, Message{Flags: fired})})
+	tick()
+	e.Publish(Message{Speed, 2})
+	tick()
+	e.Publish(Message{Speed, 0})
+	tick()
+	e.Close()
+
+	want := []string{
+		"sim 1", "render 1",
+		"sim 3", "render 3",
+		"sim 3", "render 3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if timers != 1 {
+		t.Errorf("timer fired %d times by day 3, want once", timers)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Color of a cell, the values match the termbox attributes.
+type Color uint16
+
+const (
+	ColorDefault Color = iota
+	ColorBlack
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+)
+
+// Screen is a grid of colored characters the game is drawn on. Changes
+// become visible with Flush.
+type Screen interface {
+	Size() (width, height int)
+	Clear(fg, bg Color)
+	SetCell(x, y int, ch rune, fg, bg Color)
+	Flush() error
+}
+
+// Frontend is a Screen the player plays on, it publishes the input as
+// Key, Mouse and Resize messages until Quit.
+type Frontend interface {
+	Screen
+	System
+	SetPassive(passive bool)
+}
+
+type screenCell struct {
+	ch     rune
+	fg, bg Color
+}
+
+// MemoryScreen is a Screen in memory, e.g. to run the game without a
+// terminal. It is safe to inspect while the game draws on it.
+type MemoryScreen struct {
+	sync.Mutex
+	width, height int
+	back, front   []screenCell
+	flushes       int
+}
+
+func NewMemoryScreen(width, height int) *MemoryScreen {
+	s := &MemoryScreen{}
+	s.Resize(width, height)
+	return s
+}
+
+// Resize clears the screen to the new size.
+func (s *MemoryScreen) Resize(width, height int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.width, s.height = width, height
+	s.back = make([]screenCell, width*height)
+	s.front = make([]screenCell, width*height)
+	s.clear(s.back, ColorDefault, ColorDefault)
+	s.clear(s.front, ColorDefault, ColorDefault)
+}
+
+func (s *MemoryScreen) Size() (width, height int) {
+	s.Lock()
+	defer s.Unlock()
+	return s.width, s.height
+}
+
+func (s *MemoryScreen) Clear(fg, bg Color) {
+	s.Lock()
+	defer s.Unlock()
+	s.clear(s.back, fg, bg)
+}
+
+func (s *MemoryScreen) clear(cells []screenCell, fg, bg Color) {
+	for i := range cells {
+		cells[i] = screenCell{' ', fg, bg}
+	}
+}
+
+// SetCell ignores cells outside of the screen, like termbox.
+func (s *MemoryScreen) SetCell(x, y int, ch rune, fg, bg Color) {
+	s.Lock()
+	defer s.Unlock()
+
+	if x < 0 || y < 0 || x >= s.width || y >= s.height {
+		return
+	}
+	s.back[y*s.width+x] = screenCell{ch, fg, bg}
+}
+
+func (s *MemoryScreen) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+
+	copy(s.front, s.back)
+	s.flushes++
+	return nil
+}
+
+// Cell returns a cell as last flushed.
+func (s *MemoryScreen) Cell(x, y int) (ch rune, fg, bg Color) {
+	s.Lock()
+	defer s.Unlock()
+
+	if x < 0 || y < 0 || x >= s.width || y >= s.height {
+		return ' ', ColorDefault, ColorDefault
+	}
+	c := s.front[y*s.width+x]
+	return c.ch, c.fg, c.bg
+}
+
+// Flushes is the number of frames flushed.
+func (s *MemoryScreen) Flushes() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.flushes
+}
+
+// Text returns the characters last flushed, one line per row.
+func (s *MemoryScreen) Text() string {
+	s.Lock()
+	defer s.Unlock()
+
+	var b strings.Builder
+	for y := 0; y < s.height; y++ {
+		for _, c := range s.front[y*s.width : (y+1)*s.width] {
+			b.WriteRune(c.ch)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
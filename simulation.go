@@ -32,69 +32,26 @@ const (
 	workerProducesProducts = 0.5
 )
 
-func main() {
-	rand.Seed(42)
-	log.SetFlags(0)
-
-	// A group of wild gophers appears!
-	gophers := Gophers{
-		NewGopher("Klas"), NewGopher("Sture"), NewGopher("Verner"), NewGopher("Asbjörn"),
-		NewGopher("Loke"), NewGopher("Vidar"), NewGopher("Markus"), NewGopher("Staffan"),
-		NewGopher("Knut"), NewGopher("Stian"), NewGopher("Magnus"), NewGopher("Theodor"),
-		NewGopher("Acke"), NewGopher("Stian"), NewGopher("Gunnar"), NewGopher("Halsten"),
-		NewGopher("Noak"), NewGopher("Alvar"), NewGopher("Viktor"), NewGopher("Sigvard"),
-	}
-
-	// Setup environment
-	s := SpatialSystem()
-	s.AddResidentials(
-		NewResidential(4, gophers[0:4]),
-		NewResidential(4, gophers[4:8]),
-		NewResidential(4, gophers[8:12]),
-		NewResidential(4, gophers[12:16]),
-		NewResidential(4, gophers[16:20]),
-	)
-	s.AddCommercials(
-		NewCommercial(4, nil),
-		NewCommercial(4, nil),
-		NewCommercial(4, nil),
-	)
-	s.AddIndustrials(
-		NewIndustrial(4, nil),
-		NewIndustrial(4, nil),
-	)
-
-	// Simulate
-	for step := 0; step < 10; step++ {
-		gophers.Shuffle()
-
-		gophers.Shop()
-		gophers.Work()
-		gophers.Sleep()
-	}
-
-	// Results
-	fmt.Println(gophers.String())
-	fmt.Println(SpatialSystem().String())
+// A group of wild gophers appears!
+var gopherNames = []string{
+	"Klas", "Sture", "Verner", "Asbjörn", "Loke", "Vidar", "Markus", "Staffan",
+	"Knut", "Stian", "Magnus", "Theodor", "Acke", "Stian", "Gunnar", "Halsten",
+	"Noak", "Alvar", "Viktor", "Sigvard",
 }
 
+// spatialSystem holds the buildings of a game in the order they are simulated
 type spatialSystem struct {
 	residentials []*Residential
 	commercials  []*Commercial
 	industrials  []*Industrial
 }
 
-var spatialSystemSingleton *spatialSystem
-
-func SpatialSystem() *spatialSystem {
-	if spatialSystemSingleton == nil {
-		spatialSystemSingleton = &spatialSystem{
-			residentials: []*Residential{},
-			commercials:  []*Commercial{},
-			industrials:  []*Industrial{},
-		}
+func newSpatialSystem() *spatialSystem {
+	return &spatialSystem{
+		residentials: []*Residential{},
+		commercials:  []*Commercial{},
+		industrials:  []*Industrial{},
 	}
-	return spatialSystemSingleton
 }
 
 func (s *spatialSystem) String() string {
@@ -127,6 +84,38 @@ func (s *spatialSystem) AddIndustrials(is ...*Industrial) {
 	s.industrials = append(s.industrials, is...)
 }
 
+func (s *spatialSystem) RemoveResidential(r *Residential) {
+	for i, b := range s.residentials {
+		if b == r {
+			s.residentials = append(s.residentials[:i], s.residentials[i+1:]...)
+			return
+		}
+	}
+}
+func (s *spatialSystem) RemoveCommercial(c *Commercial) {
+	for i, b := range s.commercials {
+		if b == c {
+			s.commercials = append(s.commercials[:i], s.commercials[i+1:]...)
+			return
+		}
+	}
+}
+func (s *spatialSystem) RemoveIndustrial(in *Industrial) {
+	for i, b := range s.industrials {
+		if b == in {
+			s.industrials = append(s.industrials[:i], s.industrials[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reset removes all buildings.
+func (s *spatialSystem) Reset() {
+	s.residentials = []*Residential{}
+	s.commercials = []*Commercial{}
+	s.industrials = []*Industrial{}
+}
+
 func (s *spatialSystem) Residentials() []*Residential {
 	return s.residentials
 }
@@ -225,9 +214,9 @@ func (gs *Gophers) String() string {
 	return r
 }
 
-func (gs Gophers) Shuffle() {
+func (gs Gophers) Shuffle(random *rand.Rand) {
 	for i := 0; i < len(gs); i++ {
-		j := rand.Intn(i + 1)
+		j := random.Intn(i + 1)
 		gs[i], gs[j] = gs[j], gs[i]
 	}
 }
@@ -238,12 +227,12 @@ func (gs Gophers) Sleep() {
 	}
 }
 
-func (gs Gophers) Shop() {
-	commercials := SpatialSystem().Commercials()
+func (gs Gophers) Shop(s *spatialSystem) {
+	commercials := s.Commercials()
 	for _, g := range gs {
 		Debug("{G", g.name, "} goes shopping")
 		for _, c := range commercials {
-			if c.GetGoods(gopherNeedsGoods) {
+			if c.GetGoods(s, gopherNeedsGoods) {
 				g.ShopDone()
 				break
 			}
@@ -251,9 +240,9 @@ func (gs Gophers) Shop() {
 	}
 }
 
-func (gs Gophers) Work() {
-	commercials := SpatialSystem().Commercials()
-	industrials := SpatialSystem().Industrials()
+func (gs Gophers) Work(s *spatialSystem) {
+	commercials := s.Commercials()
+	industrials := s.Industrials()
 
 	for _, g := range gs {
 		if g.HasWorked() {
@@ -262,13 +251,13 @@ func (gs Gophers) Work() {
 
 		Debug("{G", g.name, "} goes working")
 		for _, c := range commercials {
-			if c.DoWork(g) {
+			if c.DoWork(s, g) {
 				break
 			}
 		}
 		if !g.HasWorked() {
 			for _, i := range industrials {
-				if i.DoWork(g) {
+				if i.DoWork(s, g) {
 					break
 				}
 			}
@@ -319,7 +308,7 @@ func (r *Residential) GetWorker() *Gopher {
 }
 
 type Building interface {
-	DoWork(*Gopher) bool
+	DoWork(*spatialSystem, *Gopher) bool
 	RemoveWorker(*Gopher)
 }
 
@@ -359,7 +348,7 @@ func (c *Commercial) RemoveWorker(worker *Gopher) {
 	}
 }
 
-func (c *Commercial) DoWork(worker *Gopher) bool {
+func (c *Commercial) DoWork(s *spatialSystem, worker *Gopher) bool {
 	if len(c.workers) >= c.capacity {
 		Debug(c, "no more capacity")
 		return false
@@ -380,10 +369,10 @@ func (c *Commercial) DoWork(worker *Gopher) bool {
 	neededProducts := workerProducesGoods * goodNeedsProducts
 	if c.products < neededProducts {
 		Debug(c, "get products from industrials")
-		industrials := SpatialSystem().Industrials()
+		industrials := s.Industrials()
 		var gotProducts bool
 		for _, i := range industrials {
-			if gotProducts = i.GetProducts(neededProducts); gotProducts {
+			if gotProducts = i.GetProducts(s, neededProducts); gotProducts {
 				c.products += neededProducts
 				break
 			}
@@ -402,7 +391,7 @@ func (c *Commercial) DoWork(worker *Gopher) bool {
 	return true
 }
 
-func (c *Commercial) GetGoods(amount float64) bool {
+func (c *Commercial) GetGoods(s *spatialSystem, amount float64) bool {
 	// goods in stock
 	if c.goods >= amount {
 		Debug(c, "goods in stock")
@@ -428,7 +417,7 @@ func (c *Commercial) GetGoods(amount float64) bool {
 			Debug(c, "all workers are busy")
 			if len(c.workers) < c.capacity {
 				Debug(c, "hire new gopher from residentials")
-				residentials := SpatialSystem().Residentials()
+				residentials := s.Residentials()
 				for _, r := range residentials {
 					worker = r.GetWorker()
 					if worker != nil {
@@ -458,10 +447,10 @@ func (c *Commercial) GetGoods(amount float64) bool {
 		neededProducts := workerProducesGoods * goodNeedsProducts
 		if c.products < neededProducts {
 			Debug(c, "get products from industrials")
-			industrials := SpatialSystem().Industrials()
+			industrials := s.Industrials()
 			var gotProducts bool
 			for _, i := range industrials {
-				if gotProducts = i.GetProducts(neededProducts); gotProducts {
+				if gotProducts = i.GetProducts(s, neededProducts); gotProducts {
 					c.products += neededProducts
 					break
 				}
@@ -519,7 +508,7 @@ func (i *Industrial) RemoveWorker(worker *Gopher) {
 	}
 }
 
-func (i *Industrial) DoWork(worker *Gopher) bool {
+func (i *Industrial) DoWork(s *spatialSystem, worker *Gopher) bool {
 	if len(i.workers) >= i.capacity {
 		Debug(i, "no more capacity")
 		return false
@@ -539,7 +528,7 @@ func (i *Industrial) DoWork(worker *Gopher) bool {
 	return true
 }
 
-func (i *Industrial) GetProducts(amount float64) bool {
+func (i *Industrial) GetProducts(s *spatialSystem, amount float64) bool {
 	// products in stock
 	if i.products >= amount {
 		Debug(i, "products in stock")
@@ -565,7 +554,7 @@ func (i *Industrial) GetProducts(amount float64) bool {
 			Debug(i, "all workers are busy")
 			if len(i.workers) < i.capacity {
 				Debug(i, "hire new gopher from residentials")
-				residentials := SpatialSystem().Residentials()
+				residentials := s.Residentials()
 				for _, r := range residentials {
 					worker = r.GetWorker()
 					if worker != nil {
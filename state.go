@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/nsf/termbox-go"
@@ -18,29 +18,59 @@ const (
 	ModeDelete
 )
 
+var (
+	Inspect = RegisterKind("Inspect") // *Query for the Cell at a Point
+	Status  = RegisterKind("Status")  // string shown on the console
+)
+
+func init() {
+	BindPayload[*Query](Inspect)
+	BindPayload[string](Status)
+}
+
 type GameState struct {
-	running  bool
-	engine   *Engine
-	terminal *Terminal
+	running bool
+	engine  *Engine
+	screen  Screen
+	world   *World
+	clock   *Scheduler
+	index   *SpatialIndex // footprints of the buildings in world
 
 	mode    ClickMode
+	size    int // footprint of new buildings
 	console string
-
-	width, height int
+	date    Date
+	speed   int
+	paused  bool
+	debug   bool // show engine stats in the side panel
+	prompt  bool // the command line is open
+	command []rune
+	help    bool // show the key bindings
+	keymap  Keymap
+
+	width, height int // of the map, it never shrinks
 	data          []Cell
+
+	viewWidth, viewHeight int // of the screen without the console
 }
 
-func NewGameState(e *Engine, t *Terminal) *GameState {
+func NewGameState(e *Engine, s Screen, w *World, clock *Scheduler) *GameState {
 	gs := &GameState{
-		running:  true,
-		engine:   e,
-		terminal: t,
-
+		running: true,
+		engine:  e,
+		screen:  s,
+		world:   w,
+		clock:   clock,
+		index:   NewSpatialIndex(),
+
+		size:    LowBuilding,
 		console: "initalized",
+		speed:   1,
+		keymap:  DefaultKeymap(),
 	}
 
-	w, h := t.Size()
-	gs.resize(w, h)
+	width, height := s.Size()
+	gs.resize(width, height)
 
 	return gs
 }
@@ -52,24 +82,11 @@ func (gs *GameState) Handle(m Message) {
 
 	switch {
 	case m.Kind(Key):
-		switch m.Payload.(termbox.Key) {
-		case termbox.KeyEsc:
-			gs.engine.Publish(Message{Flags: Quit})
-		case termbox.KeyF1:
-			gs.mode = ModeIdle
-			gs.console = "idle mode"
-		case termbox.KeyF2:
-			gs.mode = ModeResidential
-			gs.console = "residential mode"
-		case termbox.KeyF3:
-			gs.mode = ModeCommercial
-			gs.console = "commercial mode"
-		case termbox.KeyF4:
-			gs.mode = ModeIndustrial
-			gs.console = "industrial mode"
-		case termbox.KeyF5:
-			gs.mode = ModeDelete
-			gs.console = "delete mode"
+		ke := m.Payload.(KeyEvent)
+		if gs.prompt {
+			gs.edit(ke)
+		} else {
+			gs.key(ke)
 		}
 
 	case m.Kind(Resize):
@@ -84,58 +101,186 @@ func (gs *GameState) Handle(m Message) {
 		}
 
 	case m.Kind(Tick):
-		//now := m.Payload.(time.Time)
-		gs.simulate()
 		gs.draw()
 
+	case m.Kind(Save):
+		m.Payload.(*SaveState).Game = gs.save()
+
+	case m.Kind(Restore):
+		gs.restore(m.Payload.(*SaveState))
+
+	case m.Kind(Inspect):
+		q := m.Payload.(*Query)
+		if p, ok := q.Request.(Point); ok {
+			q.Reply(gs.inspect(p.X, p.Y))
+		}
+
+	case m.Kind(Status):
+		gs.console = m.Payload.(string)
+
+	case m.Kind(Error):
+		err := m.Payload.(error)
+		gs.console = "error: " + err.Error()
+		if IsFatal(err) {
+			gs.engine.Post(Message{Flags: Quit})
+		}
+
 	case m.Kind(Quit):
 		gs.running = false
 
 	}
 }
 
-func (gs *GameState) Running() bool {
-	return gs.running
+// key runs the action bound to ke, any key closes the help
+func (gs *GameState) key(ke KeyEvent) {
+	if gs.help {
+		gs.help = false
+		return
+	}
+	if name, ok := gs.keymap[ke]; ok {
+		a, _ := lookupAction(name)
+		a.run(gs)
+	}
 }
 
-type Cell struct { // termbox.Cell
+// SetKeymap replaces the key bindings.
+func (gs *GameState) SetKeymap(km Keymap) {
+	gs.keymap = km
+}
+
+var modeNames = map[ClickMode]string{
+	ModeIdle:        "idle",
+	ModeResidential: "residential",
+	ModeCommercial:  "commercial",
+	ModeIndustrial:  "industrial",
+	ModeDelete:      "delete",
+}
+
+func (gs *GameState) setMode(mode ClickMode) {
+	gs.mode = mode
+	gs.console = modeNames[mode] + " mode"
+}
+
+func (gs *GameState) setSize(size int) {
+	gs.size = size
+	gs.console = fmt.Sprintf("size %dx%d", gs.size, gs.size)
+}
+
+// setSpeed sets and resumes the game speed
+func (gs *GameState) setSpeed(speed int) {
+	gs.speed = speed
+	gs.paused = false
+	gs.console = fmt.Sprintf("speed %dx", gs.speed)
+	gs.engine.Publish(Message{Speed, gs.speed})
+}
+
+func (gs *GameState) setPaused(paused bool) {
+	gs.paused = paused
+	if gs.paused {
+		gs.console = "paused"
+		gs.engine.Publish(Message{Speed, 0})
+	} else {
+		gs.console = fmt.Sprintf("speed %dx", gs.speed)
+		gs.engine.Publish(Message{Speed, gs.speed})
+	}
+}
+
+// saveGame publishes a Save, the Saver reports whether it succeeded
+func (gs *GameState) saveGame(path string) {
+	gs.engine.Publish(Message{Save, &SaveState{Path: path}})
+}
+
+func (gs *GameState) loadGame(path string) {
+	gs.engine.Publish(Message{Load, path})
+}
+
+func (gs *GameState) quit() {
+	gs.engine.Post(Message{Flags: Quit})
+}
+
+type Cell struct {
 	Ch     rune
-	Fg, Bg termbox.Attribute
-	Start  time.Time
+	Fg, Bg Color
+	Start  Date
 }
 
+// resize fits the view to a screen of w x h cells, the last line is the
+// console. The map grows to cover the view but never shrinks, buildings
+// outside of a smaller view are kept until it grows again.
 func (gs *GameState) resize(w, h int) {
 	h -= 1
-	if gs.width == w && gs.height == h {
+	gs.viewWidth, gs.viewHeight = w, h
+	if w <= gs.width && h <= gs.height {
 		return
 	}
 
 	oldw, oldh := gs.width, gs.height
 	olddata := gs.data
+	if w < oldw {
+		w = oldw
+	}
+	if h < oldh {
+		h = oldh
+	}
 
 	gs.width, gs.height = w, h
 	gs.data = make([]Cell, gs.width*gs.height)
 	for i := range gs.data {
 		gs.data[i].Ch = ' '
-		gs.data[i].Fg = termbox.ColorDefault
-		gs.data[i].Bg = termbox.ColorDefault
+		gs.data[i].Fg = ColorDefault
+		gs.data[i].Bg = ColorDefault
 	}
 
-	minw, minh := oldw, oldh
-	if w < minw {
-		minw = w
-	}
-	if h < minh {
-		minh = h
+	for i := 0; i < oldh; i++ {
+		copy(gs.data[i*gs.width:], olddata[i*oldw:(i+1)*oldw])
 	}
+}
+
+// GameSave is the saved map and controls.
+type GameSave struct {
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	Cells   []Cell    `json:"cells"`
+	Mode    ClickMode `json:"mode"`
+	Size    int       `json:"size"`
+	Console string    `json:"console"`
+	Speed   int       `json:"speed"`
+	Paused  bool      `json:"paused"`
+}
 
-	for i := 0; i < minh; i++ {
-		srco, dsto := i*oldw, i*gs.width
-		src := olddata[srco : srco+minw]
-		dst := gs.data[dsto : dsto+minw]
-		copy(dst, src)
+func (gs *GameState) save() *GameSave {
+	return &GameSave{
+		Width:   gs.width,
+		Height:  gs.height,
+		Cells:   append([]Cell(nil), gs.data...),
+		Mode:    gs.mode,
+		Size:    gs.size,
+		Console: gs.console,
+		Speed:   gs.speed,
+		Paused:  gs.paused,
 	}
+}
 
+// restore replaces the map with the saved one and grows it to the view,
+// the World has to be restored before
+func (gs *GameState) restore(st *SaveState) {
+	g := st.Game
+
+	gs.width, gs.height = g.Width, g.Height
+	gs.data = append([]Cell(nil), g.Cells...)
+	gs.index = NewSpatialIndex()
+	for _, e := range gs.world.Query(Geometry.Or(Zoning)) {
+		r, _ := Get[Rect](gs.world, e, Geometry)
+		gs.index.Insert(e, r)
+	}
+	gs.resize(gs.viewWidth, gs.viewHeight+1)
+
+	gs.mode = g.Mode
+	gs.size = g.Size
+	gs.console = g.Console
+	gs.speed = g.Speed
+	gs.paused = g.Paused
+	gs.date = st.Clock.Date
 }
 
 var ascii = map[string][]rune{
@@ -145,6 +290,8 @@ var ascii = map[string][]rune{
 	"thick":   []rune{'╔', '═', '╗', '║', '╚', '╝'},
 }
 
+const gopherGlyph = 'g'
+
 func (gs *GameState) paint(x, y int) {
 	gs.console = fmt.Sprintf("mouse at %v:%v", x, y)
 
@@ -154,42 +301,101 @@ func (gs *GameState) paint(x, y int) {
 		return
 	}
 
-	color := termbox.ColorDefault // ModeDelete
+	color := ColorDefault // ModeDelete
 	switch gs.mode {
 	case ModeIdle:
 		return
 	case ModeResidential:
-		color = termbox.ColorGreen
+		color = ColorGreen
 	case ModeCommercial:
-		color = termbox.ColorCyan
+		color = ColorCyan
 	case ModeIndustrial:
-		color = termbox.ColorYellow
+		color = ColorYellow
 	}
 
-	if gs.data[p].Bg == color {
+	if gs.mode == ModeDelete {
+		if e, ok := gs.index.At(Point{x, y}); ok {
+			gs.demolish(e)
+		}
+		return
+	}
+
+	r := Rect{x, y, gs.size, gs.size}
+	if r.X+r.W > gs.viewWidth || r.Y+r.H > gs.viewHeight {
+		gs.console += " out of bounds"
+		return
+	}
+	if len(gs.index.Query(r)) > 0 {
 		return
 	}
 
-	if gs.data[p].Bg != termbox.ColorDefault && color != termbox.ColorDefault {
+	e := gs.world.Create()
+	Set(gs.world, e, Geometry, r)
+	Set(gs.world, e, Zoning, gs.mode)
+	gs.index.Insert(e, r)
+
+	gs.fill(r, Cell{
+		Ch:    ' ',
+		Fg:    ColorDefault,
+		Bg:    color,
+		Start: gs.date,
+	})
+}
+
+// demolish removes the building e and clears its footprint
+func (gs *GameState) demolish(e Entity) {
+	r, ok := gs.index.Rect(e)
+	if !ok {
 		return
 	}
 
-	gs.data[p].Ch = ' '
-	gs.data[p].Fg = termbox.ColorDefault
-	gs.data[p].Bg = color
-	gs.data[p].Start = time.Now()
+	gs.fill(r, Cell{
+		Ch: ' ',
+		Fg: ColorDefault,
+		Bg: ColorDefault,
+	})
+	gs.index.Remove(e)
+	gs.world.Destroy(e)
+}
+
+// fill sets all cells of r inside the map to c
+func (gs *GameState) fill(r Rect, c Cell) {
+	for y := r.Y; y < r.Y+r.H; y++ {
+		for x := r.X; x < r.X+r.W; x++ {
+			if x >= 0 && y >= 0 && x < gs.width && y < gs.height {
+				gs.data[y*gs.width+x] = c
+			}
+		}
+	}
+}
+
+// inspect returns the cell at x, y or an empty one if out of bounds
+func (gs *GameState) inspect(x, y int) Cell {
+	if x < 0 || y < 0 || x >= gs.width || y >= gs.height {
+		return Cell{Ch: ' '}
+	}
+	return gs.data[y*gs.width+x]
+}
+
+// advance simulates the game time passed, it is subscribed to Tick in
+// PhaseSimulation, after the clock advanced and before the frame is drawn
+func (gs *GameState) advance(m Message) {
+	if date := gs.clock.Date(); date != gs.date {
+		gs.date = date
+		gs.simulate()
+	}
 }
 
 func (gs *GameState) simulate() {
 	for i, c := range gs.data {
-		if c.Bg != termbox.ColorDefault {
-			delta := time.Since(c.Start)
+		if c.Bg != ColorDefault {
+			delta := gs.date - c.Start
 			switch {
-			case 10*time.Second < delta:
+			case Days(10) < delta:
 				gs.data[i].Ch = ascii["quality"][2]
-			case 5*time.Second < delta:
+			case Days(5) < delta:
 				gs.data[i].Ch = ascii["quality"][1]
-			case 1*time.Second < delta:
+			case Days(1) < delta:
 				gs.data[i].Ch = ascii["quality"][0]
 			}
 		}
@@ -197,39 +403,158 @@ func (gs *GameState) simulate() {
 }
 
 func (gs *GameState) draw() {
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	gs.screen.Clear(ColorDefault, ColorDefault)
 
 	// data
-	for y := 0; y < gs.height; y++ {
-		for x := 0; x < gs.width; x++ {
+	for y := 0; y < gs.viewHeight && y < gs.height; y++ {
+		for x := 0; x < gs.viewWidth && x < gs.width; x++ {
 			c := gs.data[y*gs.width+x]
-			termbox.SetCell(x, y, c.Ch, c.Fg, c.Bg)
+			gs.screen.SetCell(x, y, c.Ch, c.Fg, c.Bg)
+		}
+	}
+
+	// gophers
+	for _, e := range gs.world.Query(Position) {
+		p, _ := Get[Vec](gs.world, e, Position)
+		x, y := p.Cell()
+		if x >= 0 && y >= 0 && x < gs.viewWidth && y < gs.viewHeight {
+			c := gs.data[y*gs.width+x]
+			gs.screen.SetCell(x, y, gopherGlyph, ColorBlack, c.Bg)
 		}
 	}
 
 	// console
-	for p, c := range gs.console {
-		termbox.SetCell(p, gs.height, c, termbox.ColorDefault, termbox.ColorDefault)
+	console := gs.console
+	if gs.prompt {
+		console = ":" + string(gs.command) + "_"
+	}
+	for p, c := range []rune(console) {
+		gs.screen.SetCell(p, gs.viewHeight, c, ColorDefault, ColorDefault)
 	}
 
 	// menu
-	for y := 1; y < gs.height-1; y++ {
-		termbox.SetCell(gs.width-15, y, ascii["thin"][3], termbox.ColorDefault, termbox.ColorDefault)
-		termbox.SetCell(gs.width-1, y, ascii["thin"][3], termbox.ColorDefault, termbox.ColorDefault)
+	for y := 1; y < gs.viewHeight-1; y++ {
+		gs.screen.SetCell(gs.viewWidth-15, y, ascii["thin"][3], ColorDefault, ColorDefault)
+		gs.screen.SetCell(gs.viewWidth-1, y, ascii["thin"][3], ColorDefault, ColorDefault)
 	}
-	for x := gs.width - 14; x < gs.width-1; x++ {
-		termbox.SetCell(x, 0, ascii["thin"][1], termbox.ColorDefault, termbox.ColorDefault)
-		termbox.SetCell(x, gs.height-1, ascii["thin"][1], termbox.ColorDefault, termbox.ColorDefault)
+	for x := gs.viewWidth - 14; x < gs.viewWidth-1; x++ {
+		gs.screen.SetCell(x, 0, ascii["thin"][1], ColorDefault, ColorDefault)
+		gs.screen.SetCell(x, gs.viewHeight-1, ascii["thin"][1], ColorDefault, ColorDefault)
 	}
 
-	termbox.SetCell(gs.width-15, 0, ascii["thin"][0], termbox.ColorDefault, termbox.ColorDefault)
-	termbox.SetCell(gs.width-1, 0, ascii["thin"][2], termbox.ColorDefault, termbox.ColorDefault)
+	gs.screen.SetCell(gs.viewWidth-15, 0, ascii["thin"][0], ColorDefault, ColorDefault)
+	gs.screen.SetCell(gs.viewWidth-1, 0, ascii["thin"][2], ColorDefault, ColorDefault)
 
-	termbox.SetCell(gs.width-15, gs.height-1, ascii["thin"][4], termbox.ColorDefault, termbox.ColorDefault)
-	termbox.SetCell(gs.width-1, gs.height-1, ascii["thin"][5], termbox.ColorDefault, termbox.ColorDefault)
+	gs.screen.SetCell(gs.viewWidth-15, gs.viewHeight-1, ascii["thin"][4], ColorDefault, ColorDefault)
+	gs.screen.SetCell(gs.viewWidth-1, gs.viewHeight-1, ascii["thin"][5], ColorDefault, ColorDefault)
+
+	if gs.debug {
+		gs.drawStats()
+	}
+	if gs.help {
+		gs.drawHelp()
+	}
 
 	// flush
-	if err := termbox.Flush(); err != nil {
-		log.Fatal(err)
+	if err := gs.screen.Flush(); err != nil {
+		gs.engine.Publish(Message{Error, &Failure{"draw", err, false}})
+	}
+}
+
+// drawStats fills the side panel with the engine stats, two lines per handler:
+// name and calls, average and maximum handling time in milliseconds
+func (gs *GameState) drawStats() {
+	st := gs.engine.Stats()
+
+	lines := []string{
+		fmt.Sprintf("queue %3d/%3d", st.Queued, st.MaxQueued),
+		fmt.Sprintf("posted %6d", st.Posted),
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	for _, h := range st.Handlers {
+		lines = append(lines,
+			fmt.Sprintf("%-6.6s%7d", h.Name, h.Calls),
+			fmt.Sprintf("%5.1f/%5.1fms", ms(h.Avg()), ms(h.Max)),
+		)
+	}
+
+	x := gs.viewWidth - 14
+	for i, l := range lines {
+		y := i + 1
+		if y >= gs.viewHeight-1 {
+			break
+		}
+		for p, c := range []rune(fmt.Sprintf("%-13.13s", l)) {
+			gs.screen.SetCell(x+p, y, c, ColorDefault, ColorDefault)
+		}
+	}
+}
+
+// drawHelp shows a box over the map listing the actions and their keys
+func (gs *GameState) drawHelp() {
+	lines := []string{"keys", ""}
+	for _, a := range actions {
+		keys := gs.keymap.Keys(a.name)
+		if len(keys) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-10s %s", strings.Join(keys, " "), a.help))
+	}
+	lines = append(lines, "", "press any key")
+
+	w := 0
+	for _, l := range lines {
+		if n := len([]rune(l)); n > w {
+			w = n
+		}
+	}
+
+	// inside the map, left of the side panel
+	x0, y0 := 1, 1
+	x1, y1 := x0+w+3, y0+len(lines)+1
+	if max := gs.viewWidth - 16; x1 > max {
+		x1 = max
+	}
+	if max := gs.viewHeight - 1; y1 > max {
+		y1 = max
+	}
+	if x1-x0 < 2 || y1-y0 < 2 {
+		return
+	}
+
+	thick := ascii["thick"]
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			ch := ' '
+			switch {
+			case y == y0 && x == x0:
+				ch = thick[0]
+			case y == y0 && x == x1:
+				ch = thick[2]
+			case y == y1 && x == x0:
+				ch = thick[4]
+			case y == y1 && x == x1:
+				ch = thick[5]
+			case y == y0 || y == y1:
+				ch = thick[1]
+			case x == x0 || x == x1:
+				ch = thick[3]
+			}
+			gs.screen.SetCell(x, y, ch, ColorDefault, ColorDefault)
+		}
+	}
+
+	for i, l := range lines {
+		y := y0 + 1 + i
+		if y >= y1 {
+			break
+		}
+		for p, c := range []rune(l) {
+			x := x0 + 2 + p
+			if x >= x1 {
+				break
+			}
+			gs.screen.SetCell(x, y, c, ColorDefault, ColorDefault)
+		}
 	}
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// handlerStats are updated by the dispatch goroutine and read by Stats
+type handlerStats struct {
+	calls atomic.Int64
+	total atomic.Int64 // nanoseconds
+	max   atomic.Int64 // nanoseconds
+}
+
+func (h *handlerStats) observe(d time.Duration) {
+	h.calls.Add(1)
+	h.total.Add(int64(d))
+	for {
+		m := h.max.Load()
+		if int64(d) <= m || h.max.CompareAndSwap(m, int64(d)) {
+			return
+		}
+	}
+}
+
+// HandlerStats describes the work done by a single Subscription.
+type HandlerStats struct {
+	Name  string
+	Phase Phase
+	Calls int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+func (h HandlerStats) Avg() time.Duration {
+	if h.Calls == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Calls)
+}
+
+// EngineStats is a snapshot of the Engine's queues and Subscriptions.
+type EngineStats struct {
+	Queued    int // messages waiting for dispatch
+	MaxQueued int // highest number of waiting messages so far
+	Posted    int // messages waiting for the next Tick
+	Handlers  []HandlerStats
+}
+
+// Named sets the name the Subscription is reported with in Stats.
+func (s *Subscription) Named(name string) *Subscription {
+	s.engine.Lock()
+	defer s.engine.Unlock()
+	s.name = name
+	return s
+}
+
+// String returns the name of the Subscription, or the type of its System.
+func (s *Subscription) String() string {
+	s.engine.RLock()
+	defer s.engine.RUnlock()
+	return s.displayName()
+}
+
+// displayName requires the engine lock
+func (s *Subscription) displayName() string {
+	if s.name != "" {
+		return s.name
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", s.system), "*")
+	return strings.TrimPrefix(name, "main.")
+}
+
+// Stats returns a snapshot of the Engine's instrumentation, handlers are
+// in order of Phase and subscription. Cancelled Subscriptions are omitted.
+func (e *Engine) Stats() EngineStats {
+	var st EngineStats
+
+	e.qmu.Lock()
+	st.Queued = len(e.queue)
+	st.MaxQueued = e.maxQueued
+	st.Posted = len(e.posted)
+	e.qmu.Unlock()
+
+	e.RLock()
+	for _, s := range e.all {
+		st.Handlers = append(st.Handlers, HandlerStats{
+			Name:  s.displayName(),
+			Phase: s.phase,
+			Calls: s.stats.calls.Load(),
+			Total: time.Duration(s.stats.total.Load()),
+			Max:   time.Duration(s.stats.max.Load()),
+		})
+	}
+	e.RUnlock()
+
+	sort.SliceStable(st.Handlers, func(i, j int) bool {
+		return st.Handlers[i].Phase < st.Handlers[j].Phase
+	})
+	return st
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"log"
+	"sync/atomic"
 
 	"github.com/nsf/termbox-go"
 )
 
 type Terminal struct {
-	running bool
+	running atomic.Bool // written by the engine, read by the event poller
+	passive atomic.Bool
 	engine  *Engine
 }
 
@@ -19,12 +21,12 @@ func NewTerminal(e *Engine) *Terminal {
 	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
 
 	t := &Terminal{
-		running: true,
-		engine:  e,
+		engine: e,
 	}
+	t.running.Store(true)
 
 	go func() {
-		for t.running {
+		for t.running.Load() {
 			t.HandleEvent(termbox.PollEvent())
 		}
 	}()
@@ -33,38 +35,85 @@ func NewTerminal(e *Engine) *Terminal {
 }
 
 func (t *Terminal) Handle(m Message) {
-	if m.Kind(Quit) {
-		t.running = false
+	if m.Kind(Quit) && t.running.Swap(false) {
 		termbox.Close()
 	}
 }
 
+// SetPassive stops publishing input, e.g. while replaying a session.
+// Esc still publishes Quit.
+func (t *Terminal) SetPassive(passive bool) {
+	t.passive.Store(passive)
+}
+
 func (t *Terminal) HandleEvent(ev termbox.Event) {
-	if !t.running {
+	if !t.running.Load() {
+		return
+	}
+
+	if t.passive.Load() && ev.Type != termbox.EventError {
+		// only allow to abort
+		if ev.Type == termbox.EventKey && ev.Key == termbox.KeyEsc {
+			t.engine.Publish(Message{Flags: Quit})
+		}
 		return
 	}
 
 	switch ev.Type {
 	case termbox.EventKey:
-		t.engine.Publish(Message{Key, ev.Key})
+		ke := KeyEvent{Key: ev.Key, Ch: ev.Ch}
+		if ev.Mod&termbox.ModAlt != 0 {
+			ke.Mod |= ModAlt
+		}
+		t.engine.Publish(Message{Key, ke})
 	case termbox.EventResize:
 		t.engine.Publish(Message{Resize, Point{ev.Width, ev.Height}})
 	case termbox.EventMouse:
 		t.engine.Publish(Message{Mouse, MouseEvent{ev.Key, ev.MouseX, ev.MouseY}})
 	case termbox.EventError:
-		//t.engine.Publish(Message{Error, ev.Err})
-		log.Fatal(ev.Err)
+		t.engine.Publish(Message{Error, &Failure{"terminal", ev.Err, true}})
 	}
 }
 
+// Terminal is the termbox Screen.
+var _ Screen = (*Terminal)(nil)
+
 func (t *Terminal) Size() (width, height int) {
 	return termbox.Size()
 }
 
+func (t *Terminal) Clear(fg, bg Color) {
+	termbox.Clear(termbox.Attribute(fg), termbox.Attribute(bg))
+}
+
+func (t *Terminal) SetCell(x, y int, ch rune, fg, bg Color) {
+	termbox.SetCell(x, y, ch, termbox.Attribute(fg), termbox.Attribute(bg))
+}
+
+func (t *Terminal) Flush() error {
+	return termbox.Flush()
+}
+
 type Point struct {
 	X, Y int
 }
 
+// KeyEvent is a pressed key. Printable characters have Ch set and a zero
+// Key, like termbox reports them. Control combinations are Keys, e.g.
+// termbox.KeyCtrlA.
+type KeyEvent struct {
+	Key termbox.Key
+	Ch  rune
+	Mod Mod
+}
+
+// Mod are the modifiers held while a key was pressed.
+type Mod uint8
+
+const (
+	ModAlt Mod = 1 << iota
+)
+
 type MouseEvent struct {
 	Key  termbox.Key
 	X, Y int
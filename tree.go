@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+)
+
+// kindTree is a bit-trie of subscriptions indexed by their Kind.
+// Starting at the lowest bit, every level branches on whether the
+// bit is set. A subscription is stored at the first node where no
+// higher bits of its Kind remain, so a lookup only descends into
+// the set-branch for bits present in the message and never visits
+// subscriptions requiring a bit the message does not carry.
+type kindTree struct {
+	root kindNode
+	seq  uint64
+}
+
+type kindNode struct {
+	children [2]*kindNode
+	subs     []*Subscription
+}
+
+func (t *kindTree) node(k Kind, create bool) *kindNode {
+	n := &t.root
+	for i, l := 0, k.Len(); i < l; i++ {
+		b := 0
+		if k.Has(i) {
+			b = 1
+		}
+		if n.children[b] == nil {
+			if !create {
+				return nil
+			}
+			n.children[b] = &kindNode{}
+		}
+		n = n.children[b]
+	}
+	return n
+}
+
+func (t *kindTree) insert(k Kind, s *Subscription) {
+	n := t.node(k, true)
+	n.subs = append(n.subs, s)
+}
+
+func (t *kindTree) remove(k Kind, s *Subscription) {
+	n := t.node(k, false)
+	if n == nil {
+		return
+	}
+
+	// copy, a running match may still hold the old slice
+	subs := make([]*Subscription, 0, len(n.subs))
+	for _, o := range n.subs {
+		if o != s {
+			subs = append(subs, o)
+		}
+	}
+	n.subs = subs
+}
+
+// match returns all subscriptions with a Kind contained in k,
+// each once, ordered by Phase and the order they subscribed.
+func (t *kindTree) match(k Kind) []*Subscription {
+	var found []*Subscription
+	t.root.collect(k, 0, k.Len(), &found)
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].phase != found[j].phase {
+			return found[i].phase < found[j].phase
+		}
+		return found[i].seq < found[j].seq
+	})
+
+	// a subscription to several Kinds may match more than once
+	uniq := found[:0]
+	for i, s := range found {
+		if i == 0 || found[i-1] != s {
+			uniq = append(uniq, s)
+		}
+	}
+	return uniq
+}
+
+// collect walks the node at depth i, l is the length of k
+func (n *kindNode) collect(k Kind, i, l int, found *[]*Subscription) {
+	*found = append(*found, n.subs...)
+	if i >= l {
+		// every deeper subscription requires at least one more bit
+		return
+	}
+
+	if c := n.children[0]; c != nil {
+		c.collect(k, i+1, l, found)
+	}
+	if c := n.children[1]; c != nil && k.Has(i) {
+		c.collect(k, i+1, l, found)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testKinds are registered after the Kinds of the game, so the last ones
+// lie beyond the first 64 flags
+var testKinds = func() []Kind {
+	ks := make([]Kind, 80)
+	for i := range ks {
+		ks[i] = RegisterKind(fmt.Sprintf("Test%d", i))
+	}
+	return ks
+}()
+
+// testKind returns a registered Kind whose flag is at index i or higher
+func testKind(i int) Kind {
+	for _, k := range testKinds {
+		if k.Len() > i {
+			return k
+		}
+	}
+	panic(fmt.Sprintf("no test kind beyond flag %d", i))
+}
+
+func TestKindTreeMatch(t *testing.T) {
+	lo, hi := testKind(8), testKind(64)
+
+	var tree kindTree
+	subscribe := func(p Phase, name string, kinds ...Kind) *Subscription {
+		tree.seq++
+		s := &Subscription{name: name, phase: p, seq: tree.seq, kinds: kinds}
+		for _, k := range kinds {
+			tree.insert(k, s)
+		}
+		return s
+	}
+	subscribe(PhaseSimulation, "all", None)
+	subscribe(PhaseRender, "tick", Tick)
+	multi := subscribe(PhaseSimulation, "multi", Tick, Key, hi)
+	subscribe(PhaseInput, "both", Kinds(Tick, Key))
+	subscribe(PhasePostSimulation, "high", hi)
+	subscribe(PhaseSimulation, "pair", Kinds(lo, hi))
+
+	tests := []struct {
+		flags Kind
+		want  []string
+	}{
+		{None, []string{"all"}},
+		{Quit, []string{"all"}},
+		{Tick, []string{"all", "multi", "tick"}},
+		{Kinds(Tick, Key), []string{"both", "all", "multi", "tick"}},
+		{lo, []string{"all"}},
+		{hi, []string{"all", "multi", "high"}},
+		{Kinds(lo, hi), []string{"all", "multi", "pair", "high"}},
+		{Kinds(Tick, Key, lo, hi), []string{"both", "all", "multi", "pair", "high", "tick"}},
+	}
+	for _, tt := range tests {
+		if got := subscriptionNames(tree.match(tt.flags)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("match(%v) = %v, want %v", tt.flags, got, tt.want)
+		}
+	}
+
+	for _, k := range multi.kinds {
+		tree.remove(k, multi)
+	}
+	if got, want := subscriptionNames(tree.match(Kinds(Tick, hi))), []string{"all", "high", "tick"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("match after remove = %v, want %v", got, want)
+	}
+}
+
+func subscriptionNames(subs []*Subscription) []string {
+	names := []string{}
+	for _, s := range subs {
+		names = append(names, s.name)
+	}
+	return names
+}
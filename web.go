@@ -0,0 +1,404 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nsf/termbox-go"
+)
+
+//go:embed web.html
+var webPage []byte
+
+// Web is a Screen shown by browsers connected over a WebSocket. Their
+// key, mouse and resize events are published like those of a Terminal,
+// the last resized browser sets the size of the Screen.
+type Web struct {
+	running atomic.Bool
+	passive atomic.Bool
+	engine  *Engine
+	server  *http.Server
+	public  bool // served to any host, not only to loopback addresses
+
+	mu            sync.Mutex
+	width, height int
+	back, front   []screenCell
+	full          bool // the next frame is sent completely
+	clients       map[*webClient]bool
+}
+
+type webClient struct {
+	conn *wsConn
+	send chan []byte
+}
+
+// webBacklog is the number of frames queued for a client, a client falling
+// further behind is disconnected
+const webBacklog = 64
+
+// NewWeb serves the front-end at addr until Quit. Anyone reaching addr
+// plays the game, including its command line writing save files, so addr
+// must be a loopback address unless public is set. Requests for other
+// hosts than a loopback address are rejected as well, or a site resolving
+// its name to the loopback address could connect.
+func NewWeb(e *Engine, addr string, public bool) (*Web, error) {
+	if !public && !loopback(addr) {
+		return nil, fmt.Errorf("%v is not a loopback address, anyone reaching it could play", addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	wb := newWeb(e, public)
+	wb.server = &http.Server{Handler: wb.handler()}
+
+	go func() {
+		err := wb.server.Serve(ln)
+		if wb.running.Load() && !errors.Is(err, http.ErrServerClosed) {
+			e.Publish(Message{Error, &Failure{"web", err, true}})
+		}
+	}()
+	log.Printf("serving on http://%v", ln.Addr())
+
+	return wb, nil
+}
+
+func newWeb(e *Engine, public bool) *Web {
+	wb := &Web{
+		engine:  e,
+		public:  public,
+		clients: make(map[*webClient]bool),
+	}
+	wb.running.Store(true)
+	wb.resize(80, 24)
+	return wb
+}
+
+func (wb *Web) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", wb.page)
+	mux.HandleFunc("/ws", wb.connect)
+	return mux
+}
+
+// loopback reports whether addr only listens on the local machine
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return loopbackHost(host)
+}
+
+// loopbackHost reports whether host is localhost or a loopback IP
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// allowHost rejects requests for another host than a loopback address,
+// unless wb is public
+func (wb *Web) allowHost(w http.ResponseWriter, r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host // without a port
+	}
+	if !wb.public && !loopbackHost(host) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (wb *Web) Handle(m Message) {
+	if m.Kind(Quit) && wb.running.Swap(false) {
+		wb.server.Close()
+
+		wb.mu.Lock()
+		defer wb.mu.Unlock()
+		for c := range wb.clients {
+			wb.drop(c)
+		}
+	}
+}
+
+// SetPassive stops publishing input, e.g. while replaying a session.
+// Esc still publishes Quit.
+func (wb *Web) SetPassive(passive bool) {
+	wb.passive.Store(passive)
+}
+
+func (wb *Web) page(w http.ResponseWriter, r *http.Request) {
+	if !wb.allowHost(w, r) {
+		return
+	}
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(webPage)
+}
+
+func (wb *Web) connect(w http.ResponseWriter, r *http.Request) {
+	if !wb.allowHost(w, r) {
+		return
+	}
+	conn, err := wsUpgrade(w, r)
+	if err != nil {
+		return
+	}
+	c := &webClient{
+		conn: conn,
+		send: make(chan []byte, webBacklog),
+	}
+
+	wb.mu.Lock()
+	if !wb.running.Load() {
+		wb.mu.Unlock()
+		conn.Close()
+		return
+	}
+	wb.clients[c] = true
+	c.send <- wb.frame(wb.front, nil)
+	wb.mu.Unlock()
+
+	go func() {
+		for msg := range c.send {
+			if conn.WriteText(msg) != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var ev webEvent
+		if json.Unmarshal(msg, &ev) == nil {
+			wb.HandleEvent(ev)
+		}
+	}
+
+	wb.mu.Lock()
+	wb.drop(c)
+	wb.mu.Unlock()
+}
+
+// drop disconnects c, wb.mu is held
+func (wb *Web) drop(c *webClient) {
+	if wb.clients[c] {
+		delete(wb.clients, c)
+		close(c.send)
+	}
+}
+
+// webEvent is an event of a browser
+type webEvent struct {
+	Type   string `json:"type"` // key, mousedown, mouseup, wheel or resize
+	Key    string `json:"key"`  // KeyboardEvent.key
+	Alt    bool   `json:"alt"`
+	Ctrl   bool   `json:"ctrl"`
+	Button int    `json:"button"`
+	Delta  int    `json:"delta"`
+	X      int    `json:"x"` // cell of mouse events, size of resize events
+	Y      int    `json:"y"`
+}
+
+// webKeys translates the KeyboardEvent keys of the browser
+var webKeys = map[string]termbox.Key{
+	"Escape": termbox.KeyEsc, "Enter": termbox.KeyEnter, "Tab": termbox.KeyTab,
+	"Backspace": termbox.KeyBackspace2, "Delete": termbox.KeyDelete, "Insert": termbox.KeyInsert,
+	" ": termbox.KeySpace, "Home": termbox.KeyHome, "End": termbox.KeyEnd,
+	"PageUp": termbox.KeyPgup, "PageDown": termbox.KeyPgdn,
+	"ArrowUp": termbox.KeyArrowUp, "ArrowDown": termbox.KeyArrowDown,
+	"ArrowLeft": termbox.KeyArrowLeft, "ArrowRight": termbox.KeyArrowRight,
+	"F1": termbox.KeyF1, "F2": termbox.KeyF2, "F3": termbox.KeyF3, "F4": termbox.KeyF4,
+	"F5": termbox.KeyF5, "F6": termbox.KeyF6, "F7": termbox.KeyF7, "F8": termbox.KeyF8,
+	"F9": termbox.KeyF9, "F10": termbox.KeyF10, "F11": termbox.KeyF11, "F12": termbox.KeyF12,
+}
+
+// keyEvent translates a key event like a terminal reports it
+func (ev webEvent) keyEvent() (KeyEvent, bool) {
+	var ke KeyEvent
+	if ev.Alt {
+		ke.Mod |= ModAlt
+	}
+
+	if k, ok := webKeys[ev.Key]; ok {
+		ke.Key = k
+		return ke, true
+	}
+
+	r := []rune(ev.Key)
+	switch {
+	case len(r) != 1:
+		// Shift, Control and others not producing a character
+		return ke, false
+	case ev.Ctrl && r[0] >= 'a' && r[0] <= 'z':
+		ke.Key = termbox.KeyCtrlA + termbox.Key(r[0]-'a')
+	case ev.Ctrl:
+		return ke, false
+	default:
+		ke.Ch = r[0]
+	}
+	return ke, true
+}
+
+// webButtons translates MouseEvent.button
+var webButtons = []termbox.Key{termbox.MouseLeft, termbox.MouseMiddle, termbox.MouseRight}
+
+// HandleEvent publishes the event of a browser as Key, Mouse or Resize.
+func (wb *Web) HandleEvent(ev webEvent) {
+	if !wb.running.Load() {
+		return
+	}
+
+	if wb.passive.Load() {
+		// only allow to abort
+		if ev.Type == "key" && ev.Key == "Escape" {
+			wb.engine.Publish(Message{Flags: Quit})
+		}
+		return
+	}
+
+	switch ev.Type {
+	case "key":
+		if ke, ok := ev.keyEvent(); ok {
+			wb.engine.Publish(Message{Key, ke})
+		}
+	case "mousedown":
+		if ev.Button >= 0 && ev.Button < len(webButtons) {
+			wb.engine.Publish(Message{Mouse, MouseEvent{webButtons[ev.Button], ev.X, ev.Y}})
+		}
+	case "mouseup":
+		wb.engine.Publish(Message{Mouse, MouseEvent{termbox.MouseRelease, ev.X, ev.Y}})
+	case "wheel":
+		k := termbox.MouseWheelDown
+		if ev.Delta < 0 {
+			k = termbox.MouseWheelUp
+		}
+		wb.engine.Publish(Message{Mouse, MouseEvent{k, ev.X, ev.Y}})
+	case "resize":
+		if ev.X <= 0 || ev.Y <= 0 || ev.X*ev.Y > 1<<16 {
+			return
+		}
+		wb.mu.Lock()
+		wb.resize(ev.X, ev.Y)
+		wb.mu.Unlock()
+		wb.engine.Publish(Message{Resize, Point{ev.X, ev.Y}})
+	}
+}
+
+// Web is a Screen.
+var _ Screen = (*Web)(nil)
+
+// resize clears the screen to the new size, wb.mu is held
+func (wb *Web) resize(width, height int) {
+	if width == wb.width && height == wb.height {
+		return
+	}
+	wb.width, wb.height = width, height
+	wb.back = make([]screenCell, width*height)
+	wb.front = make([]screenCell, width*height)
+	for i := range wb.back {
+		wb.back[i] = screenCell{' ', ColorDefault, ColorDefault}
+		wb.front[i] = wb.back[i]
+	}
+	wb.full = true
+}
+
+func (wb *Web) Size() (width, height int) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return wb.width, wb.height
+}
+
+func (wb *Web) Clear(fg, bg Color) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for i := range wb.back {
+		wb.back[i] = screenCell{' ', fg, bg}
+	}
+}
+
+func (wb *Web) SetCell(x, y int, ch rune, fg, bg Color) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if x >= 0 && y >= 0 && x < wb.width && y < wb.height {
+		wb.back[y*wb.width+x] = screenCell{ch, fg, bg}
+	}
+}
+
+// Flush sends the cells changed since the last frame to all browsers.
+func (wb *Web) Flush() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	prev := wb.front
+	if wb.full {
+		prev = nil
+	}
+	msg := wb.frame(wb.back, prev)
+	copy(wb.front, wb.back)
+	wb.full = false
+	if msg == nil {
+		return nil
+	}
+
+	for c := range wb.clients {
+		select {
+		case c.send <- msg:
+		default:
+			wb.drop(c)
+		}
+	}
+	return nil
+}
+
+// webFrame is sent to the browsers. Cells are flattened into groups of
+// index, character, foreground and background. A full frame replaces
+// the whole screen.
+type webFrame struct {
+	Width  int           `json:"w"`
+	Height int           `json:"h"`
+	Full   bool          `json:"full,omitempty"`
+	Cells  []interface{} `json:"cells"`
+}
+
+// frame encodes the cells differing from prev, all if prev is nil, or
+// returns nil if none changed. wb.mu is held.
+func (wb *Web) frame(cells, prev []screenCell) []byte {
+	f := webFrame{Width: wb.width, Height: wb.height, Full: prev == nil}
+	for i, c := range cells {
+		if prev != nil && c == prev[i] {
+			continue
+		}
+		ch := c.ch
+		if ch == 0 {
+			ch = ' '
+		}
+		f.Cells = append(f.Cells, i, string(ch), c.fg, c.bg)
+	}
+	if len(f.Cells) == 0 && !f.Full {
+		return nil
+	}
+
+	msg, _ := json.Marshal(f)
+	return msg
+}
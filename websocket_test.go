@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWSUpgradeOrigin(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+	srv := httptest.NewServer(newWeb(e, false).handler())
+	defer srv.Close()
+	public := httptest.NewServer(newWeb(e, true).handler())
+	defer public.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	_, port, _ := net.SplitHostPort(host)
+	publicHost := strings.TrimPrefix(public.URL, "http://")
+	_, publicPort, _ := net.SplitHostPort(publicHost)
+
+	tests := []struct {
+		dial, host, origin string
+		status             int
+	}{
+		{host, host, "http://" + host, http.StatusSwitchingProtocols},
+		{host, "localhost:" + port, "http://localhost:" + port, http.StatusSwitchingProtocols},
+		{host, host, "", http.StatusForbidden},
+		{host, host, "http://evil.example", http.StatusForbidden},
+		{host, host, "http://" + host + ".evil.example", http.StatusForbidden},
+		{host, host, "%", http.StatusForbidden},
+		// DNS rebinding: evil.example resolves to the loopback address
+		{host, "evil.example:" + port, "http://evil.example:" + port, http.StatusForbidden},
+		{publicHost, "evil.example:" + publicPort, "http://evil.example:" + publicPort, http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", tt.dial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := "GET /ws HTTP/1.1\r\nHost: " + tt.host + "\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+		if tt.origin != "" {
+			req += "Origin: " + tt.origin + "\r\n"
+		}
+		fmt.Fprint(conn, req+"\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("host %q, origin %q: status %d, want %d", tt.host, tt.origin, resp.StatusCode, tt.status)
+		}
+		conn.Close()
+	}
+
+	// the page is not served to other hosts either
+	for h, status := range map[string]int{host: http.StatusOK, "evil.example:" + port: http.StatusForbidden} {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Host = h
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("page for host %q: status %d, want %d", h, resp.StatusCode, status)
+		}
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"localhost:8070", true},
+		{"127.0.0.1:8070", true},
+		{"[::1]:8070", true},
+		{":8070", false},
+		{"0.0.0.0:8070", false},
+		{"192.168.1.2:8070", false},
+		{"example.com:8070", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		if got := loopback(tt.addr); got != tt.want {
+			t.Errorf("loopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Entity identifies a thing in the World, it is only a bag of components.
+type Entity uint64
+
+// EntityEvent is the payload of Add, Update and Remove messages. Their
+// flags also carry the affected component Kinds.
+type EntityEvent struct {
+	Entity Entity
+	Mask   Kind // components of the entity after the change
+}
+
+func init() {
+	BindPayload[EntityEvent](Add)
+	BindPayload[EntityEvent](Update)
+	BindPayload[EntityEvent](Remove)
+}
+
+// componentStore holds all components of a single Kind
+type componentStore interface {
+	remove(Entity)
+	encode(Entity) (json.RawMessage, error)
+	decode(Entity, json.RawMessage) error
+}
+
+type store[T any] struct {
+	data map[Entity]T
+}
+
+func newStore[T any]() componentStore {
+	return &store[T]{data: make(map[Entity]T)}
+}
+
+func (s *store[T]) remove(e Entity) {
+	delete(s.data, e)
+}
+
+func (s *store[T]) encode(e Entity) (json.RawMessage, error) {
+	return json.Marshal(s.data[e])
+}
+
+func (s *store[T]) decode(e Entity, data json.RawMessage) error {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.data[e] = v
+	return nil
+}
+
+// components maps registered component Kinds to their storage
+var components = map[Kind]func() componentStore{}
+
+// RegisterComponent binds the component Kind k to values of type T.
+// Only registered components are saved with the World.
+func RegisterComponent[T any](k Kind) {
+	components[k] = newStore[T]
+}
+
+// World stores entities and their components. Every change is published
+// through the Engine: Add|<component> when a component is set the first
+// time, Update|<component> when it is replaced and Remove|<component>
+// when it is removed. World is not safe for concurrent use, it belongs
+// to the dispatch goroutine.
+type World struct {
+	engine *Engine
+	last   Entity
+	masks  map[Entity]Kind
+	stores map[Kind]componentStore
+}
+
+func NewWorld(e *Engine) *World {
+	return &World{
+		engine: e,
+		masks:  make(map[Entity]Kind),
+		stores: make(map[Kind]componentStore),
+	}
+}
+
+// Create returns a new Entity without components.
+func (w *World) Create() Entity {
+	w.last++
+	w.masks[w.last] = None
+	return w.last
+}
+
+// Alive reports whether e was created and not destroyed.
+func (w *World) Alive(e Entity) bool {
+	_, ok := w.masks[e]
+	return ok
+}
+
+// Mask returns the component Kinds of e.
+func (w *World) Mask(e Entity) Kind {
+	return w.masks[e]
+}
+
+// Destroy removes e with all its components.
+func (w *World) Destroy(e Entity) {
+	mask, ok := w.masks[e]
+	if !ok {
+		return
+	}
+
+	for k, s := range w.stores {
+		if mask.Contains(k) {
+			s.remove(e)
+		}
+	}
+	delete(w.masks, e)
+
+	w.engine.Publish(Message{Remove.Or(mask), EntityEvent{e, None}})
+}
+
+// Query returns all entities having at least the components of mask,
+// in order of creation.
+func (w *World) Query(mask Kind) []Entity {
+	var r []Entity
+	for e, m := range w.masks {
+		if m.Contains(mask) {
+			r = append(r, e)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+func storeOf[T any](w *World, k Kind) *store[T] {
+	cs, ok := w.stores[k]
+	if !ok {
+		if f, registered := components[k]; registered {
+			cs = f()
+		} else {
+			cs = newStore[T]()
+		}
+		w.stores[k] = cs
+	}
+
+	s, ok := cs.(*store[T])
+	if !ok {
+		panic(fmt.Sprintf("component %v is not a %T", k, *new(T)))
+	}
+	return s
+}
+
+// Set sets the component k of e to v. All components of a Kind must have
+// the same type.
+func Set[T any](w *World, e Entity, k Kind, v T) {
+	mask, ok := w.masks[e]
+	if !ok {
+		panic(fmt.Sprintf("set %v of unknown entity %d", k, e))
+	}
+
+	storeOf[T](w, k).data[e] = v
+
+	if mask.Contains(k) {
+		w.engine.Publish(Message{Update.Or(k), EntityEvent{e, mask}})
+		return
+	}
+	mask = mask.Or(k)
+	w.masks[e] = mask
+	w.engine.Publish(Message{Add.Or(k), EntityEvent{e, mask}})
+}
+
+// Get returns the component k of e.
+func Get[T any](w *World, e Entity, k Kind) (T, bool) {
+	if !w.masks[e].Contains(k) {
+		var zero T
+		return zero, false
+	}
+	v, ok := storeOf[T](w, k).data[e]
+	return v, ok
+}
+
+// Unset removes the component k of e.
+func (w *World) Unset(e Entity, k Kind) {
+	mask, ok := w.masks[e]
+	if !ok || !mask.Contains(k) {
+		return
+	}
+
+	w.stores[k].remove(e)
+	mask = mask.AndNot(k)
+	w.masks[e] = mask
+	w.engine.Publish(Message{Remove.Or(k), EntityEvent{e, mask}})
+}
+
+// EntityState is an Entity with its encoded components, keyed by Kind name.
+type EntityState struct {
+	ID         Entity                     `json:"id"`
+	Components map[string]json.RawMessage `json:"components"`
+}
+
+// WorldState is the saved World.
+type WorldState struct {
+	Last     Entity        `json:"last"`
+	Entities []EntityState `json:"entities"`
+}
+
+// Snapshot encodes all entities and their components.
+func (w *World) Snapshot() (*WorldState, error) {
+	ws := &WorldState{Last: w.last}
+
+	for _, e := range w.Query(None) {
+		es := EntityState{
+			ID:         e,
+			Components: make(map[string]json.RawMessage),
+		}
+		for k, s := range w.stores {
+			if !w.masks[e].Contains(k) {
+				continue
+			}
+			if _, ok := components[k]; !ok {
+				return nil, fmt.Errorf("component %v is not registered", k)
+			}
+			data, err := s.encode(e)
+			if err != nil {
+				return nil, fmt.Errorf("entity %d: %v: %v", e, k, err)
+			}
+			es.Components[k.String()] = data
+		}
+		ws.Entities = append(ws.Entities, es)
+	}
+	return ws, nil
+}
+
+// Restore replaces all entities with those of ws. Unlike Set and Destroy
+// it publishes no messages, systems restore their own state on Restore.
+// On error the World is left unchanged.
+func (w *World) Restore(ws *WorldState) error {
+	masks, stores, err := ws.decode()
+	if err != nil {
+		return err
+	}
+
+	w.last = ws.Last
+	w.masks = masks
+	w.stores = stores
+	return nil
+}
+
+// decode checks and decodes all entities of ws
+func (ws *WorldState) decode() (map[Entity]Kind, map[Kind]componentStore, error) {
+	masks := make(map[Entity]Kind)
+	stores := make(map[Kind]componentStore)
+
+	for _, es := range ws.Entities {
+		if es.ID == 0 || es.ID > ws.Last {
+			return nil, nil, fmt.Errorf("entity %d out of range", es.ID)
+		}
+		if _, ok := masks[es.ID]; ok {
+			return nil, nil, fmt.Errorf("entity %d is duplicated", es.ID)
+		}
+
+		mask := None
+		for name, data := range es.Components {
+			k, ok := LookupKind(name)
+			if !ok {
+				return nil, nil, fmt.Errorf("entity %d: unknown component %q", es.ID, name)
+			}
+			f, ok := components[k]
+			if !ok {
+				return nil, nil, fmt.Errorf("entity %d: component %v is not registered", es.ID, k)
+			}
+			if _, ok := stores[k]; !ok {
+				stores[k] = f()
+			}
+			if err := stores[k].decode(es.ID, data); err != nil {
+				return nil, nil, fmt.Errorf("entity %d: %v: %v", es.ID, k, err)
+			}
+			mask = mask.Or(k)
+		}
+		masks[es.ID] = mask
+	}
+	return masks, stores, nil
+}
+
+// Handle saves the World on Save and restores it on Restore.
+func (w *World) Handle(m Message) {
+	switch {
+	case m.Kind(Save):
+		st := m.Payload.(*SaveState)
+		ws, err := w.Snapshot()
+		if err != nil {
+			w.engine.Publish(Message{Error, &Failure{"save", err, false}})
+			return
+		}
+		st.World = ws
+
+	case m.Kind(Restore):
+		st := m.Payload.(*SaveState)
+		if err := w.Restore(st.World); err != nil {
+			w.engine.Publish(Message{Error, &Failure{"load", err, false}})
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var (
+	testCount = testKinds[23]
+	testName  = testKinds[24]
+	testLocal = testKinds[25] // set but not registered
+)
+
+func init() {
+	RegisterComponent[int](testCount)
+	RegisterComponent[string](testName)
+}
+
+func TestWorldEvents(t *testing.T) {
+	e := NewEngine()
+	var got []Message
+	e.SubscribeFunc(func(m Message) { got = append(got, m) }, Add, Update, Remove)
+
+	w := NewWorld(e)
+	a := w.Create()
+	Set(w, a, testCount, 1)
+	Set(w, a, testCount, 2)
+	Set(w, a, testName, "a")
+	w.Unset(a, testCount)
+	w.Unset(a, testCount)
+	Set(w, a, testCount, 3)
+	w.Destroy(a)
+	w.Destroy(a)
+	e.Close()
+
+	want := []Message{
+		{Kinds(Add, testCount), EntityEvent{a, testCount}},
+		{Kinds(Update, testCount), EntityEvent{a, testCount}},
+		{Kinds(Add, testName), EntityEvent{a, Kinds(testCount, testName)}},
+		{Kinds(Remove, testCount), EntityEvent{a, testName}},
+		{Kinds(Add, testCount), EntityEvent{a, Kinds(testCount, testName)}},
+		{Kinds(Remove, testCount, testName), EntityEvent{a, None}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published\n%v\nwant\n%v", got, want)
+	}
+	if w.Alive(a) {
+		t.Error("destroyed entity is alive")
+	}
+}
+
+func TestWorldQuery(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	w := NewWorld(e)
+	var counted, named []Entity
+	for i := 0; i < 20; i++ {
+		en := w.Create()
+		if i%2 == 0 {
+			Set(w, en, testCount, i)
+			counted = append(counted, en)
+		}
+		if i%3 == 0 {
+			Set(w, en, testName, "x")
+			if i%2 == 0 {
+				named = append(named, en)
+			}
+		}
+	}
+	if got := w.Query(testCount); !reflect.DeepEqual(got, counted) {
+		t.Errorf("Query(%v) = %v, want %v", testCount, got, counted)
+	}
+	if got := w.Query(Kinds(testCount, testName)); !reflect.DeepEqual(got, named) {
+		t.Errorf("Query(%v) = %v, want %v", Kinds(testCount, testName), got, named)
+	}
+	if got := w.Query(None); len(got) != 20 {
+		t.Errorf("Query(None) = %v, want all entities", got)
+	}
+}
+
+func TestWorldSnapshot(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	w := NewWorld(e)
+	a, b := w.Create(), w.Create()
+	Set(w, a, testCount, 7)
+	Set(w, a, testName, "a")
+	Set(w, b, testName, "b")
+	w.Destroy(w.Create())
+
+	ws, err := w.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// through JSON, like a save file
+	data, err := json.Marshal(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded WorldState
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewWorld(e)
+	if err := r.Restore(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Query(None); !reflect.DeepEqual(got, []Entity{a, b}) {
+		t.Errorf("restored entities %v, want %v", got, []Entity{a, b})
+	}
+	if n, _ := Get[int](r, a, testCount); n != 7 || r.Mask(a) != Kinds(testCount, testName) {
+		t.Errorf("restored %v with %v = %d", a, r.Mask(a), n)
+	}
+	if s, _ := Get[string](r, b, testName); s != "b" || r.Mask(b) != testName {
+		t.Errorf("restored %v with %v = %q", b, r.Mask(b), s)
+	}
+	if c := r.Create(); c != 4 {
+		t.Errorf("created %d after restoring, want 4", c)
+	}
+
+	Set(w, a, testLocal, 1.5)
+	if _, err := w.Snapshot(); err == nil {
+		t.Error("snapshot of an unregistered component succeeded")
+	}
+}
+
+func TestWorldRestoreError(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	w := NewWorld(e)
+	a := w.Create()
+	Set(w, a, testCount, 1)
+
+	for _, c := range []map[string]json.RawMessage{
+		{testCount.String(): json.RawMessage(`2`), "Nope": json.RawMessage(`1`)},
+		{testCount.String(): json.RawMessage(`2`), testLocal.String(): json.RawMessage(`1.5`)},
+		{testCount.String(): json.RawMessage(`"two"`)},
+	} {
+		ws := &WorldState{Last: 2, Entities: []EntityState{{ID: 2, Components: c}}}
+		if err := w.Restore(ws); err == nil {
+			t.Errorf("restored components %s", c)
+		}
+		if n, _ := Get[int](w, a, testCount); n != 1 || !reflect.DeepEqual(w.Query(None), []Entity{a}) {
+			t.Errorf("World changed by a failed Restore of %s", c)
+		}
+	}
+}